@@ -0,0 +1,163 @@
+// Package census implements the signatures of the census over the xi_R it contributes
+// to xi: the census signs H(cm_u||nu_1||xi_R||epoch), which is valid for a limited
+// number of epochs only, so that a signature can not be reused in later periods.
+//
+// The xi circuit takes the epoch as a public input: verifiers of the proof check it
+// against their current epoch with CheckEpoch.
+//
+// Service and Toss implement the coin tossing of xi: the user sends cm_u and nu_1, the
+// census answers with xi_R and its signature, a single xi_R being issued per nu_1.
+package census
+
+import (
+	"blockchain_DP/hashfunctions"
+	"blockchain_DP/xicircuit"
+	"errors"
+	"time"
+
+	fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/signature"
+)
+
+// DefaultEpochLength is the length of the epochs of the default clock.
+const DefaultEpochLength = time.Hour
+
+var (
+	ErrExpired     = errors.New("census signature expired")
+	ErrFutureEpoch = errors.New("census signature for a future epoch")
+	ErrSignature   = errors.New("invalid census signature")
+)
+
+// Clock returns the current epoch.
+type Clock func() uint64
+
+// TimeClock returns the clock counting epochs of the given length since the Unix epoch.
+func TimeClock(length time.Duration) Clock {
+	return func() uint64 {
+		return uint64(time.Now().UnixNano() / int64(length))
+	}
+}
+
+type config struct {
+	clock    Clock
+	validity uint64
+}
+
+// Option configures a Signer or a Verifier.
+type Option func(*config)
+
+// WithClock sets the clock giving the current epoch, TimeClock(DefaultEpochLength) by
+// default.
+func WithClock(clock Clock) Option {
+	return func(cfg *config) {
+		cfg.clock = clock
+	}
+}
+
+// WithValidity sets the number of epochs a signature is valid for, starting with the
+// epoch it was issued in. Signatures are only valid in their epoch by default.
+func WithValidity(epochs uint64) Option {
+	return func(cfg *config) {
+		cfg.validity = epochs
+	}
+}
+
+func newConfig(opts []Option) config {
+	cfg := config{clock: TimeClock(DefaultEpochLength), validity: 1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.validity == 0 {
+		cfg.validity = 1
+	}
+	return cfg
+}
+
+// CheckEpoch checks that a signature issued in epoch is valid in the current epoch,
+// being valid for the given number of epochs.
+func CheckEpoch(epoch, current, validity uint64) error {
+	if epoch > current {
+		return ErrFutureEpoch
+	}
+	if current-epoch >= validity {
+		return ErrExpired
+	}
+	return nil
+}
+
+// Signature is the signature of the census over xi_R, issued in Epoch.
+type Signature struct {
+	Epoch      uint64
+	SignedData []byte
+	Signature  []byte
+}
+
+// Signer signs the xi_R of the census in the current epoch.
+type Signer struct {
+	hashID hashfunctions.HashID
+	key    signature.Signer
+	clock  Clock
+}
+
+// NewSigner returns the signer of the census of the given key. WithValidity is ignored.
+func NewSigner(h hashfunctions.HashID, key signature.Signer, opts ...Option) *Signer {
+	cfg := newConfig(opts)
+	return &Signer{hashID: h, key: key, clock: cfg.clock}
+}
+
+// Public returns the public key of the census.
+func (s *Signer) Public() signature.PublicKey {
+	return s.key.Public()
+}
+
+// Sign signs xi_R for the commitment cm_u to xi_U and the nu_1 of the user.
+func (s *Signer) Sign(cmXiUser, nu1 []byte, xiCensus fr.Element) (*Signature, error) {
+	if err := s.hashID.Check(); err != nil {
+		return nil, err
+	}
+	sig := &Signature{Epoch: s.clock()}
+	sig.SignedData = xicircuit.SignedData(s.hashID, cmXiUser, nu1, xiCensus, sig.Epoch)
+
+	var err error
+	if sig.Signature, err = s.key.Sign(sig.SignedData, s.hashID.New()); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// Verifier checks census signatures in the current epoch.
+type Verifier struct {
+	hashID   hashfunctions.HashID
+	pk       signature.PublicKey
+	clock    Clock
+	validity uint64
+}
+
+// NewVerifier returns the verifier of the signatures of the census of key pk.
+func NewVerifier(h hashfunctions.HashID, pk signature.PublicKey, opts ...Option) *Verifier {
+	cfg := newConfig(opts)
+	return &Verifier{hashID: h, pk: pk, clock: cfg.clock, validity: cfg.validity}
+}
+
+// CheckEpoch checks that a signature issued in epoch is valid in the current epoch.
+func (v *Verifier) CheckEpoch(epoch uint64) error {
+	return CheckEpoch(epoch, v.clock(), v.validity)
+}
+
+// Verify checks that sig is a signature of xi_R for cm_u and nu_1, valid in the current
+// epoch.
+func (v *Verifier) Verify(cmXiUser, nu1 []byte, xiCensus fr.Element, sig *Signature) error {
+	if err := v.hashID.Check(); err != nil {
+		return err
+	}
+	if err := v.CheckEpoch(sig.Epoch); err != nil {
+		return err
+	}
+
+	data := xicircuit.SignedData(v.hashID, cmXiUser, nu1, xiCensus, sig.Epoch)
+	ok, err := v.pk.Verify(sig.Signature, data, v.hashID.New())
+	if err != nil || !ok {
+		return ErrSignature
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package census
+
+import (
+	"blockchain_DP/hashfunctions"
+	"blockchain_DP/ldp"
+	"blockchain_DP/xicircuit"
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+	"github.com/consensys/gnark/test"
+)
+
+func TestCensusSignature(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	var epoch uint64 = 10
+	clock := func() uint64 { return epoch }
+
+	key, err := eddsa.GenerateKey(rand.Reader)
+	assert.NoError(err)
+	signer := NewSigner(hashfunctions.MiMC, key, WithClock(clock))
+
+	var cmXiUser, nu1, xiCensus fr.Element
+	for _, e := range []*fr.Element{&cmXiUser, &nu1, &xiCensus} {
+		_, err = e.SetRandom()
+		assert.NoError(err)
+	}
+	cm, nu := cmXiUser.Marshal(), nu1.Marshal()
+
+	sig, err := signer.Sign(cm, nu, xiCensus)
+	assert.NoError(err)
+	assert.Equal(epoch, sig.Epoch)
+
+	verifier := NewVerifier(hashfunctions.MiMC, signer.Public(), WithClock(clock))
+	assert.NoError(verifier.Verify(cm, nu, xiCensus, sig))
+
+	// another xi_R, or the key of another census
+	assert.ErrorIs(verifier.Verify(cm, nu, cmXiUser, sig), ErrSignature)
+	other, err := eddsa.GenerateKey(rand.Reader)
+	assert.NoError(err)
+	assert.ErrorIs(NewVerifier(hashfunctions.MiMC, other.Public(), WithClock(clock)).Verify(cm, nu, xiCensus, sig), ErrSignature)
+
+	// the signature expires with its epoch
+	epoch++
+	assert.ErrorIs(verifier.Verify(cm, nu, xiCensus, sig), ErrExpired)
+
+	// unless it is valid for several epochs
+	lenient := NewVerifier(hashfunctions.MiMC, signer.Public(), WithClock(clock), WithValidity(2))
+	assert.NoError(lenient.Verify(cm, nu, xiCensus, sig))
+	epoch++
+	assert.ErrorIs(lenient.Verify(cm, nu, xiCensus, sig), ErrExpired)
+
+	// a signature claiming a later epoch is not valid yet
+	forged := *sig
+	forged.Epoch = epoch + 1
+	assert.ErrorIs(verifier.Verify(cm, nu, xiCensus, &forged), ErrFutureEpoch)
+	epoch = forged.Epoch
+	assert.ErrorIs(verifier.Verify(cm, nu, xiCensus, &forged), ErrSignature)
+}
+
+func TestCensusService(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	clock := func() uint64 { return 3 }
+	key, err := eddsa.GenerateKey(rand.Reader)
+	assert.NoError(err)
+	signer := NewSigner(hashfunctions.MiMC, key, WithClock(clock))
+	server := httptest.NewServer(NewService(signer))
+	defer server.Close()
+
+	var req Request
+	_, err = req.CMXiUser.SetRandom()
+	assert.NoError(err)
+	_, err = req.Nu1.SetRandom()
+	assert.NoError(err)
+
+	issue := func(req interface{}) *http.Response {
+		body, err := json.Marshal(req)
+		assert.NoError(err)
+		res, err := http.Post(server.URL, "application/json", bytes.NewReader(body))
+		assert.NoError(err)
+		return res
+	}
+
+	// the user checks the signature of xi_R before using it
+	res := issue(&req)
+	assert.Equal(http.StatusOK, res.StatusCode)
+	var resp Response
+	assert.NoError(json.NewDecoder(res.Body).Decode(&resp))
+	res.Body.Close()
+	verifier := NewVerifier(hashfunctions.MiMC, signer.Public(), WithClock(clock))
+	assert.NoError(verifier.Verify(req.CMXiUser.Marshal(), req.Nu1.Marshal(), resp.XiCensus, resp.Signature))
+
+	// the same request gets the same xi_R, but no other xi_R is issued for the same nu_1
+	res = issue(&req)
+	var again Response
+	assert.NoError(json.NewDecoder(res.Body).Decode(&again))
+	res.Body.Close()
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.True(again.XiCensus.Equal(&resp.XiCensus))
+
+	other := req
+	_, err = other.CMXiUser.SetRandom()
+	assert.NoError(err)
+	res = issue(&other)
+	res.Body.Close()
+	assert.Equal(http.StatusConflict, res.StatusCode)
+
+	// other notes get their own xi_R
+	_, err = other.Nu1.SetRandom()
+	assert.NoError(err)
+	res = issue(&other)
+	res.Body.Close()
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	res = issue("not a request")
+	res.Body.Close()
+	assert.Equal(http.StatusBadRequest, res.StatusCode)
+
+	res, err = http.Get(server.URL)
+	assert.NoError(err)
+	res.Body.Close()
+	assert.Equal(http.StatusMethodNotAllowed, res.StatusCode)
+}
+
+func TestCensusServicePersistence(t *testing.T) {
+	assert := test.NewAssert(t)
+	dir := t.TempDir()
+
+	var epoch uint64 = 3
+	clock := func() uint64 { return epoch }
+	key, err := eddsa.GenerateKey(rand.Reader)
+	assert.NoError(err)
+	signer := NewSigner(hashfunctions.MiMC, key, WithClock(clock))
+
+	service, err := OpenService(dir, signer)
+	assert.NoError(err)
+	var req Request
+	for _, e := range []*fr.Element{&req.CMXiUser, &req.Nu1} {
+		_, err = e.SetRandom()
+		assert.NoError(err)
+	}
+	res, err := service.Issue(&req)
+	assert.NoError(err)
+	assert.NoError(service.Close())
+
+	// a restart does not let the user try other coins
+	service, err = OpenService(dir, signer)
+	assert.NoError(err)
+	other := req
+	_, err = other.CMXiUser.SetRandom()
+	assert.NoError(err)
+	_, err = service.Issue(&other)
+	assert.ErrorIs(err, ErrIssued)
+	assert.Equal(1, service.Retries(req.Nu1))
+
+	// nor does waiting for the signature to expire: the nu_1 issued are kept forever,
+	// and a replay only renews the signature
+	path := filepath.Join(dir, issuedLogFile)
+	before, err := os.Stat(path)
+	assert.NoError(err)
+	epoch += 100
+	again, err := service.Issue(&req)
+	assert.NoError(err)
+	assert.True(again.XiCensus.Equal(&res.XiCensus))
+	assert.Equal(epoch, again.Signature.Epoch)
+	after, err := os.Stat(path)
+	assert.NoError(err)
+	assert.Equal(before.Size(), after.Size())
+	assert.NoError(service.Close())
+
+	service, err = OpenService(dir, signer)
+	assert.NoError(err)
+	_, err = service.Issue(&other)
+	assert.ErrorIs(err, ErrIssued)
+	assert.NoError(service.Close())
+}
+
+func TestCoinTossing(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	var epoch uint64 = 3
+	clock := func() uint64 { return epoch }
+	key, err := eddsa.GenerateKey(rand.Reader)
+	assert.NoError(err)
+	signer := NewSigner(hashfunctions.MiMC, key, WithClock(clock))
+	service := NewService(signer)
+	verifier := NewVerifier(hashfunctions.MiMC, signer.Public(), WithClock(clock))
+
+	var nu1 fr.Element
+	_, err = nu1.SetRandom()
+	assert.NoError(err)
+	toss, err := NewToss(hashfunctions.MiMC, nu1)
+	assert.NoError(err)
+	res, err := service.Issue(toss.Request())
+	assert.NoError(err)
+
+	var in xicircuit.XiWitnessInput
+	assert.NoError(toss.Finish(verifier, res, &in))
+	assert.True(in.XiCensus.Equal(&res.XiCensus))
+	assert.Equal(res.Signature.Epoch, in.Epoch)
+	var cm fr.Element
+	cm.SetBytes(hashfunctions.MiMC.Commit(in.RXiUser, in.XiUser))
+	assert.True(cm.Equal(&toss.Request().CMXiUser), "xi_U is the one committed to")
+
+	// a retry in a later epoch gets the same xi_R, signed for the new epoch
+	epoch++
+	assert.ErrorIs(toss.Finish(verifier, res, &in), ErrExpired)
+	again, err := service.Issue(toss.Request())
+	assert.NoError(err)
+	assert.True(again.XiCensus.Equal(&res.XiCensus))
+	assert.Equal(epoch, again.Signature.Epoch)
+	assert.NoError(toss.Finish(verifier, again, &in))
+
+	// the response to another user
+	other, err := NewToss(hashfunctions.MiMC, nu1)
+	assert.NoError(err)
+	assert.ErrorIs(other.Finish(verifier, again, &in), ErrSignature)
+	assert.ErrorIs(other.Finish(verifier, &Response{}, &in), ErrResponse)
+}
+
+// TestCoinTossingGrinding simulates a user who abandons the transaction and starts over
+// with a new xi_U until the first coin of xi hides its ID.
+func TestCoinTossingGrinding(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	const attempts = 32
+	key, err := eddsa.GenerateKey(rand.Reader)
+	assert.NoError(err)
+	signer := NewSigner(hashfunctions.MiMC, key)
+	verifier := NewVerifier(hashfunctions.MiMC, signer.Public())
+
+	var nu1 fr.Element
+	_, err = nu1.SetRandom()
+	assert.NoError(err)
+
+	// grind returns the coins of each xi the user obtains from the census
+	grind := func(census func() *Service) (coins [][2]int) {
+		for i := 0; i < attempts; i++ {
+			toss, err := NewToss(hashfunctions.MiMC, nu1)
+			assert.NoError(err)
+			res, err := census().Issue(toss.Request())
+			if err != nil {
+				assert.ErrorIs(err, ErrIssued)
+				continue
+			}
+			var in xicircuit.XiWitnessInput
+			assert.NoError(toss.Finish(verifier, res, &in))
+			var xi fr.Element
+			xi.Add(&in.XiUser, &in.XiCensus)
+			c0, c1 := ldp.GetCoinsFromRho(xi)
+			coins = append(coins, [2]int{c0, c1})
+			if c0 == 1 {
+				break
+			}
+		}
+		return coins
+	}
+
+	// a census which forgets the nu_1 it issued lets the user pick its coins
+	coins := grind(func() *Service { return NewService(signer) })
+	assert.Equal(1, coins[len(coins)-1][0], "the user obtains favourable coins")
+
+	// the census issues a single xi_R for the notes: the user is stuck with its first
+	// coins, and every retry is detected
+	service := NewService(signer)
+	coins = grind(func() *Service { return service })
+	assert.Equal(1, len(coins))
+	if coins[0][0] == 0 {
+		assert.Equal(attempts-1, service.Retries(nu1))
+	}
+}
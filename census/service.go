@@ -0,0 +1,195 @@
+package census
+
+import (
+	"blockchain_DP/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
+)
+
+const (
+	// maxRequestSize bounds the body of the requests of the HTTP handler.
+	maxRequestSize = 1 << 12
+
+	issuedLogFile      = "issued.log"
+	recordIssued  byte = 1
+)
+
+var ErrIssued = errors.New("xi_R already issued for nu_1")
+
+// Request is the request of a user for xi_R: the commitment cm_u to its share xi_U of
+// xi, and the nu_1 of the notes it spends.
+type Request struct {
+	CMXiUser fr.Element
+	Nu1      fr.Element
+}
+
+// Response is the share xi_R of the census and its signature. The user then sets
+// xi = xi_U + xi_R.
+type Response struct {
+	XiCensus  fr.Element
+	Signature *Signature
+}
+
+// Service is the census side of the coin tossing of xi. It issues a single xi_R per
+// nu_1, so that a user can not abandon the transaction and ask again for the same notes
+// until it gets coins it likes: the same request gets the same response, a request
+// with another commitment is refused and counted as a retry. As the nullifier set, the
+// nu_1 issued are never forgotten. It is safe for concurrent use.
+type Service struct {
+	signer *Signer
+
+	mu     sync.Mutex
+	issued map[fr.Element]*issuance
+	log    *store.Log
+}
+
+// issuance is the xi_R issued for a nu_1.
+type issuance struct {
+	cmXiUser fr.Element
+	xiCensus fr.Element
+	retries  int
+}
+
+// NewService returns the service of the census signing with signer, which keeps the
+// nu_1 issued in memory only.
+func NewService(signer *Signer) *Service {
+	return &Service{signer: signer, issued: make(map[fr.Element]*issuance)}
+}
+
+// OpenService returns the service of the census signing with signer, which persists the
+// nu_1 issued in dir, so that a restart does not let users ask again for the same notes.
+// Retries are only counted since the service was opened.
+func OpenService(dir string, signer *Signer) (*Service, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := NewService(signer)
+	var err error
+	if s.log, err = store.OpenLog(filepath.Join(dir, issuedLogFile), s.apply); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close closes the log of the service.
+func (s *Service) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.log == nil {
+		return nil
+	}
+	return s.log.Close()
+}
+
+// Issue samples xi_R for the request and signs it. If xi_R was already issued for its
+// nu_1, the same xi_R is signed again in the current epoch for the same commitment to
+// xi_U, so that a delayed transaction can still be proven, and ErrIssued is returned
+// for another commitment. A new xi_R is persisted before returning.
+func (s *Service) Issue(req *Request) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, ok := s.issued[req.Nu1]
+	if ok && !prev.cmXiUser.Equal(&req.CMXiUser) {
+		prev.retries++
+		return nil, ErrIssued
+	}
+
+	var res Response
+	if ok {
+		res.XiCensus = prev.xiCensus
+	} else if _, err := res.XiCensus.SetRandom(); err != nil {
+		return nil, err
+	}
+	var err error
+	if res.Signature, err = s.signer.Sign(req.CMXiUser.Marshal(), req.Nu1.Marshal(), res.XiCensus); err != nil {
+		return nil, err
+	}
+	if ok {
+		return &res, nil
+	}
+
+	next := &issuance{cmXiUser: req.CMXiUser, xiCensus: res.XiCensus}
+	if s.log != nil {
+		if err = s.log.Append(recordIssued, encodeIssuance(req.Nu1, next)); err != nil {
+			return nil, err
+		}
+	}
+	s.issued[req.Nu1] = next
+	return &res, nil
+}
+
+// apply replays a record of the log.
+func (s *Service) apply(t byte, payload []byte) error {
+	if t != recordIssued || len(payload) != 3*fr.Bytes {
+		return fmt.Errorf("%w: invalid record in the log of the census", store.ErrCorrupted)
+	}
+	var nu1 fr.Element
+	var next issuance
+	nu1.SetBytes(payload[:fr.Bytes])
+	next.cmXiUser.SetBytes(payload[fr.Bytes : 2*fr.Bytes])
+	next.xiCensus.SetBytes(payload[2*fr.Bytes:])
+	s.issued[nu1] = &next
+	return nil
+}
+
+// encodeIssuance returns nu_1||cm_u||xi_R.
+func encodeIssuance(nu1 fr.Element, in *issuance) []byte {
+	payload := make([]byte, 0, 3*fr.Bytes)
+	for _, e := range []*fr.Element{&nu1, &in.cmXiUser, &in.xiCensus} {
+		b := e.Bytes()
+		payload = append(payload, b[:]...)
+	}
+	return payload
+}
+
+// Retries returns the number of requests for nu_1 refused since xi_R was issued, each
+// of them being a user trying other coins for the same notes.
+func (s *Service) Retries(nu1 fr.Element) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if prev, ok := s.issued[nu1]; ok {
+		return prev.retries
+	}
+	return 0
+}
+
+// ServeHTTP serves Issue: it reads a Request in JSON from the body of a POST request and
+// writes the Response in JSON. A retry for a nu_1 already issued is answered with 409
+// Conflict.
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req Request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+		http.Error(w, "malformed request", http.StatusBadRequest)
+		return
+	}
+
+	res, err := s.Issue(&req)
+	switch {
+	case errors.Is(err, ErrIssued):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,61 @@
+package census
+
+import (
+	"blockchain_DP/hashfunctions"
+	"blockchain_DP/xicircuit"
+	"errors"
+
+	fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
+)
+
+var ErrResponse = errors.New("malformed census response")
+
+// Toss is the user side of the coin tossing of xi = xi_U + xi_R. The user commits to
+// xi_U before the census picks xi_R, and the xi circuit opens the commitment, so neither
+// chooses the coins of xi. The user does not reveal xi_U to the census, which must not
+// learn the coins.
+type Toss struct {
+	hashID   hashfunctions.HashID
+	xiUser   fr.Element
+	rXiUser  fr.Element
+	cmXiUser fr.Element
+	nu1      fr.Element
+}
+
+// NewToss samples xi_U for the notes of the given nu_1 and commits to it.
+func NewToss(h hashfunctions.HashID, nu1 fr.Element) (*Toss, error) {
+	if err := h.Check(); err != nil {
+		return nil, err
+	}
+	t := &Toss{hashID: h, nu1: nu1}
+	if _, err := t.xiUser.SetRandom(); err != nil {
+		return nil, err
+	}
+	if _, err := t.rXiUser.SetRandom(); err != nil {
+		return nil, err
+	}
+	t.cmXiUser.SetBytes(h.Commit(t.rXiUser, t.xiUser))
+	return t, nil
+}
+
+// Request returns the request sent to the census.
+func (t *Toss) Request() *Request {
+	return &Request{CMXiUser: t.cmXiUser, Nu1: t.nu1}
+}
+
+// Finish checks the response of the census and sets the coin toss of in: xi_U and the
+// randomness of its commitment, xi_R and its signature.
+func (t *Toss) Finish(v *Verifier, res *Response, in *xicircuit.XiWitnessInput) error {
+	if res.Signature == nil {
+		return ErrResponse
+	}
+	if err := v.Verify(t.cmXiUser.Marshal(), t.nu1.Marshal(), res.XiCensus, res.Signature); err != nil {
+		return err
+	}
+
+	in.XiUser, in.RXiUser, in.XiCensus = t.xiUser, t.rXiUser, res.XiCensus
+	in.Epoch = res.Signature.Epoch
+	in.CensusSignature = res.Signature.Signature
+	in.CensusPK = v.pk
+	return nil
+}
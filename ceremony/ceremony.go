@@ -0,0 +1,619 @@
+// Package ceremony runs the multi-party computation of the groth16 keys of a circuit
+// (e.g. xicircuit.NewXiCircuit(n) or deltacircuit.NewDeltaCircuit(n)), as in Bowe,
+// Gabizon and Miers (https://eprint.iacr.org/2017/1050).
+//
+// The ceremony lives in a directory shared by the participants, who take turns running
+// Contribute, possibly from different processes. It has two phases:
+//
+//   - phase 1 computes the powers of tau. Init starts it from τ = α = β = 1, which
+//     anyone can recompute, so that its runner learns nothing. Every contribution
+//     multiplies τ, α and β by secrets and appends to the transcript proofs that it
+//     knows them.
+//   - StartPhase2 derives the keys of the circuit from the powers of tau, with
+//     γ = δ = 1. Every contribution then multiplies delta by a secret d and divides the
+//     delta-dependent parts of the proving key by d, and appends to the transcript a
+//     proof that it knows d.
+//
+// As long as one participant of each phase discards its secrets, no one can forge
+// proofs. Unlike Bowe, Gabizon and Miers, phase 1 does not end with a random beacon.
+package ceremony
+
+import (
+	"blockchain_DP/prover"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	curve "github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/fft"
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/frontend"
+)
+
+const (
+	srsTranscriptFile = "phase1.transcript"
+	srsFile           = "phase1.srs"
+	transcriptFile    = "transcript"
+	phase2File        = "phase2.keys"
+	lockFile          = "contribution.lock"
+
+	transcriptDomain = "ZKAT-VDP/ceremony"
+)
+
+var (
+	ErrExists          = errors.New("ceremony already initialized")
+	ErrBusy            = errors.New("another contribution is in progress")
+	ErrNoContributions = errors.New("ceremony has no contribution")
+	ErrInvalidKeys     = errors.New("keys do not match the transcript")
+	ErrInvalidProof    = errors.New("invalid contribution")
+	ErrPhase1          = errors.New("phase 2 of the ceremony not started")
+	ErrPhase2          = errors.New("phase 2 of the ceremony already started")
+)
+
+// contribution is a transcript entry: the new delta, and the proof of knowledge of
+// the update d from the previous delta ([s]1, [s*d]1 and [d]R where R is derived
+// from the transcript so far, [s]1 and [s*d]1).
+type contribution struct {
+	delta1 curve.G1Affine
+	delta2 curve.G2Affine
+	s      curve.G1Affine
+	sd     curve.G1Affine
+	rd     curve.G2Affine
+}
+
+// transcript is the header (circuit fingerprint, hash of the transcript of phase 1 and
+// initial delta) followed by the contributions of phase 2. Its hash after each
+// contribution identifies that contribution.
+type transcript struct {
+	fingerprint   []byte
+	srsHash       []byte
+	delta1        curve.G1Affine
+	delta2        curve.G2Affine
+	contributions []contribution
+}
+
+// Init starts the ceremony of circuit in dir, from powers of tau with τ = α = β = 1.
+func Init(dir string, circuit frontend.Circuit) error {
+	if _, err := os.Stat(filepath.Join(dir, srsTranscriptFile)); err == nil {
+		return ErrExists
+	}
+
+	ccs, err := prover.Compile(circuit)
+	if err != nil {
+		return err
+	}
+	fingerprint, err := prover.Fingerprint(ccs)
+	if err != nil {
+		return err
+	}
+	r1cs, _, err := constraintSystem(ccs)
+	if err != nil {
+		return err
+	}
+	size := fft.NewDomain(uint64(len(r1cs.Constraints))).Cardinality
+	if size < 2 {
+		size = 2
+	}
+
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err = writeFile(filepath.Join(dir, srsFile), newSRS(int(size))); err != nil {
+		return err
+	}
+	t := &srsTranscript{fingerprint: fingerprint, size: size}
+	return writeFile(filepath.Join(dir, srsTranscriptFile), t)
+}
+
+// Contribute adds a contribution to the ceremony in dir, to phase 1 or to phase 2 once
+// it is started, and returns its hash, which the participant can later find in the
+// output of Verify.
+func Contribute(dir string) ([]byte, error) {
+	unlock, err := lock(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if _, err = os.Stat(filepath.Join(dir, transcriptFile)); err == nil {
+		return contributePhase2(dir)
+	}
+	return contributePhase1(dir)
+}
+
+func contributePhase1(dir string) ([]byte, error) {
+	t, err := readSRSTranscript(filepath.Join(dir, srsTranscriptFile))
+	if err != nil {
+		return nil, err
+	}
+	s, err := readSRS(filepath.Join(dir, srsFile))
+	if err != nil {
+		return nil, err
+	}
+	if len(s.tau2) < 2 || s.head() != t.head() {
+		return nil, ErrInvalidKeys
+	}
+
+	c, err := t.contribute(s)
+	if err != nil {
+		return nil, err
+	}
+
+	// as in phase 2, the powers of tau are replaced before the transcript is updated
+	if err = writeFile(filepath.Join(dir, srsFile), s); err != nil {
+		return nil, err
+	}
+	t.contributions = append(t.contributions, *c)
+	if err = writeFile(filepath.Join(dir, srsTranscriptFile), t); err != nil {
+		return nil, err
+	}
+
+	hashes := t.hashes()
+	return hashes[len(hashes)-1], nil
+}
+
+func contributePhase2(dir string) ([]byte, error) {
+	t, err := readTranscript(filepath.Join(dir, transcriptFile))
+	if err != nil {
+		return nil, err
+	}
+	keys, err := readKeyPair(filepath.Join(dir, phase2File))
+	if err != nil {
+		return nil, err
+	}
+	delta1, delta2 := t.delta()
+	if !keys.pk.delta1.Equal(&delta1) || !keys.pk.delta2.Equal(&delta2) {
+		return nil, ErrInvalidKeys
+	}
+
+	var d, s, dInv fr.Element
+	if _, err = d.SetRandom(); err != nil {
+		return nil, err
+	}
+	if _, err = s.SetRandom(); err != nil {
+		return nil, err
+	}
+	dInv.Inverse(&d)
+
+	var c contribution
+	c.delta1.ScalarMultiplication(&delta1, toBigInt(&d))
+	c.delta2.ScalarMultiplication(&delta2, toBigInt(&d))
+	_, _, g1, _ := curve.Generators()
+	c.s.ScalarMultiplication(&g1, toBigInt(&s))
+	c.sd.ScalarMultiplication(&c.s, toBigInt(&d))
+	r, err := t.challenge(&c)
+	if err != nil {
+		return nil, err
+	}
+	c.rd.ScalarMultiplication(&r, toBigInt(&d))
+
+	keys.pk.delta1, keys.vk.delta1 = c.delta1, c.delta1
+	keys.pk.delta2, keys.vk.delta2 = c.delta2, c.delta2
+	scale(keys.pk.z, toBigInt(&dInv))
+	scale(keys.pk.k, toBigInt(&dInv))
+
+	// the keys are replaced before the transcript is updated: if interrupted in
+	// between, the next contribution fails with ErrInvalidKeys instead of being
+	// accepted on top of keys that the transcript does not account for.
+	if err = writeFile(filepath.Join(dir, phase2File), keys); err != nil {
+		return nil, err
+	}
+	t.contributions = append(t.contributions, c)
+	if err = writeFile(filepath.Join(dir, transcriptFile), t); err != nil {
+		return nil, err
+	}
+
+	hashes := t.hashes()
+	return hashes[len(hashes)-1], nil
+}
+
+// StartPhase2 verifies phase 1 of the ceremony in dir, which must have a contribution,
+// and derives from its powers of tau the keys of circuit which phase 2 updates.
+func StartPhase2(dir string, circuit frontend.Circuit) error {
+	unlock, err := lock(dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err = os.Stat(filepath.Join(dir, transcriptFile)); err == nil {
+		return ErrPhase2
+	}
+	_, fingerprint, srsHashes, keys, err := verifyPhase1(dir, circuit)
+	if err != nil {
+		return err
+	}
+	if len(srsHashes) == 1 {
+		return ErrNoContributions
+	}
+
+	if err = writeFile(filepath.Join(dir, phase2File), keys); err != nil {
+		return err
+	}
+	t := &transcript{fingerprint: fingerprint, srsHash: srsHashes[len(srsHashes)-1], delta1: keys.pk.delta1, delta2: keys.pk.delta2}
+	return writeFile(filepath.Join(dir, transcriptFile), t)
+}
+
+// Verify checks the ceremony in dir: that it was run for circuit, that every
+// contribution is valid and that the current powers of tau and keys result from them.
+// It returns the hash of every contribution, those of phase 1 first.
+func Verify(dir string, circuit frontend.Circuit) ([][]byte, error) {
+	_, _, hashes, err := verify(dir, circuit)
+	return hashes, err
+}
+
+// Finalize verifies the ceremony in dir and writes its keys in out with prover.WriteKeys.
+// Both phases must have a contribution.
+func Finalize(dir, out string, circuit frontend.Circuit) error {
+	ccs, keys, _, err := verify(dir, circuit)
+	if err != nil {
+		return err
+	}
+	if keys == nil {
+		return ErrPhase1
+	}
+	t, err := readTranscript(filepath.Join(dir, transcriptFile))
+	if err != nil {
+		return err
+	}
+	if len(t.contributions) == 0 {
+		return ErrNoContributions
+	}
+
+	pk, vk, err := keys.groth16()
+	if err != nil {
+		return err
+	}
+	return prover.WriteKeys(out, &prover.Keys{Backend: backend.GROTH16, CCS: ccs, PK: pk, VK: vk})
+}
+
+// verify verifies both phases and returns the keys of phase 2, nil if it is not
+// started.
+func verify(dir string, circuit frontend.Circuit) (frontend.CompiledConstraintSystem, *keyPair, [][]byte, error) {
+	ccs, fingerprint, srsHashes, initial, err := verifyPhase1(dir, circuit)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	hashes := srsHashes[1:]
+
+	t, err := readTranscript(filepath.Join(dir, transcriptFile))
+	if os.IsNotExist(err) {
+		return ccs, nil, hashes, nil
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !bytes.Equal(t.fingerprint, fingerprint) {
+		return nil, nil, nil, prover.ErrFingerprintMismatch
+	}
+	if !bytes.Equal(t.srsHash, srsHashes[len(srsHashes)-1]) {
+		return nil, nil, nil, ErrInvalidProof
+	}
+	if len(hashes) == 0 {
+		return nil, nil, nil, ErrNoContributions
+	}
+	if err = t.verify(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	keys, err := readKeyPair(filepath.Join(dir, phase2File))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !initial.pk.delta1.Equal(&t.delta1) || !initial.pk.delta2.Equal(&t.delta2) {
+		return nil, nil, nil, ErrInvalidKeys
+	}
+	if err = verifyKeys(initial, keys, t); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return ccs, keys, append(hashes, t.hashes()[1:]...), nil
+}
+
+// verifyPhase1 verifies phase 1 and returns the hashes of its transcript and the keys
+// derived from its powers of tau.
+func verifyPhase1(dir string, circuit frontend.Circuit) (frontend.CompiledConstraintSystem, []byte, [][]byte, *keyPair, error) {
+	ccs, err := prover.Compile(circuit)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	fingerprint, err := prover.Fingerprint(ccs)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	t, err := readSRSTranscript(filepath.Join(dir, srsTranscriptFile))
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if !bytes.Equal(t.fingerprint, fingerprint) {
+		return nil, nil, nil, nil, prover.ErrFingerprintMismatch
+	}
+	if err = t.verify(); err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	s, err := readSRS(filepath.Join(dir, srsFile))
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	head := t.head()
+	if err = s.verify(t.size, &head); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	keys, err := s.keys(ccs)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	return ccs, fingerprint, t.hashes(), keys, nil
+}
+
+// verifyKeys checks that keys are the phase-1 keys updated with the delta of t.
+func verifyKeys(phase1, keys *keyPair, t *transcript) error {
+	delta1, delta2 := t.delta()
+	if !keys.sameSRS(phase1) ||
+		!keys.pk.delta1.Equal(&delta1) || !keys.vk.delta1.Equal(&delta1) ||
+		!keys.pk.delta2.Equal(&delta2) || !keys.vk.delta2.Equal(&delta2) {
+		return ErrInvalidKeys
+	}
+
+	// Z and K were divided by the product of the updates: check a random linear
+	// combination of them, e(sum(rho_i*P'_i), delta') = e(sum(rho_i*P_i), delta)
+	before := append(append([]curve.G1Affine{}, phase1.pk.z...), phase1.pk.k...)
+	after := append(append([]curve.G1Affine{}, keys.pk.z...), keys.pk.k...)
+	rho := make([]fr.Element, len(before))
+	for i := range rho {
+		if _, err := rho[i].SetRandom(); err != nil {
+			return err
+		}
+	}
+
+	var sumBefore, sumAfter curve.G1Affine
+	config := ecc.MultiExpConfig{ScalarsMont: true}
+	if _, err := sumBefore.MultiExp(before, rho, config); err != nil {
+		return err
+	}
+	if _, err := sumAfter.MultiExp(after, rho, config); err != nil {
+		return err
+	}
+	sumBefore.Neg(&sumBefore)
+
+	if err := pairingCheck([]curve.G1Affine{sumAfter, sumBefore}, []curve.G2Affine{delta2, phase1.pk.delta2}); err != nil {
+		if err == ErrInvalidProof {
+			return ErrInvalidKeys
+		}
+		return err
+	}
+	return nil
+}
+
+// delta returns the current delta of the ceremony.
+func (t *transcript) delta() (curve.G1Affine, curve.G2Affine) {
+	if len(t.contributions) == 0 {
+		return t.delta1, t.delta2
+	}
+	last := t.contributions[len(t.contributions)-1]
+	return last.delta1, last.delta2
+}
+
+// verify checks every contribution of the transcript.
+func (t *transcript) verify() error {
+	_, _, g1, g2 := curve.Generators()
+	var g1Neg curve.G1Affine
+	g1Neg.Neg(&g1)
+
+	prev := &transcript{fingerprint: t.fingerprint, srsHash: t.srsHash, delta1: t.delta1, delta2: t.delta2}
+	for i := range t.contributions {
+		c := &t.contributions[i]
+		if c.s.IsInfinity() || c.sd.IsInfinity() || c.delta1.IsInfinity() {
+			return ErrInvalidProof
+		}
+		r, err := prev.challenge(c)
+		if err != nil {
+			return err
+		}
+		delta1, _ := prev.delta()
+
+		var sdNeg, delta1Neg curve.G1Affine
+		sdNeg.Neg(&c.sd)
+		delta1Neg.Neg(&c.delta1)
+
+		// knowledge of d: e(s, [d]R) = e([s*d], R)
+		if err = pairingCheck([]curve.G1Affine{c.s, sdNeg}, []curve.G2Affine{c.rd, r}); err != nil {
+			return err
+		}
+		// delta1 was multiplied by d: e(delta1_prev, [d]R) = e(delta1, R)
+		if err = pairingCheck([]curve.G1Affine{delta1, delta1Neg}, []curve.G2Affine{c.rd, r}); err != nil {
+			return err
+		}
+		// delta2 matches delta1: e(delta1, g2) = e(g1, delta2)
+		if err = pairingCheck([]curve.G1Affine{c.delta1, g1Neg}, []curve.G2Affine{g2, c.delta2}); err != nil {
+			return err
+		}
+
+		prev.contributions = append(prev.contributions, *c)
+	}
+
+	return nil
+}
+
+// challenge derives R, the point in G2 the update of c is applied to, from the
+// transcript before c and from [s]1 and [s*d]1.
+func (t *transcript) challenge(c *contribution) (curve.G2Affine, error) {
+	hashes := t.hashes()
+	return challengeG2(hashes[len(hashes)-1], transcriptDomain, &c.s, &c.sd)
+}
+
+// challengeG2 hashes msg||[s]1||[s*x]1 to G2.
+func challengeG2(msg []byte, domain string, s, sx *curve.G1Affine) (curve.G2Affine, error) {
+	msg = append([]byte{}, msg...)
+	sBytes := s.RawBytes()
+	sxBytes := sx.RawBytes()
+	msg = append(msg, sBytes[:]...)
+	msg = append(msg, sxBytes[:]...)
+
+	return curve.HashToCurveG2Svdw(msg, []byte(domain))
+}
+
+// hashes returns the hash of the transcript header followed by the hash of the
+// transcript after each contribution.
+func (t *transcript) hashes() [][]byte {
+	var buf bytes.Buffer
+	header := &transcript{fingerprint: t.fingerprint, srsHash: t.srsHash, delta1: t.delta1, delta2: t.delta2}
+	header.WriteTo(&buf)
+	h := sha256.Sum256(buf.Bytes())
+	hashes := [][]byte{h[:]}
+
+	for i := range t.contributions {
+		buf.Reset()
+		buf.Write(hashes[i])
+		t.contributions[i].writeTo(curve.NewEncoder(&buf))
+		h := sha256.Sum256(buf.Bytes())
+		hashes = append(hashes, h[:])
+	}
+
+	return hashes
+}
+
+func (t *transcript) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write([]byte(transcriptDomain))
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := w.Write(append(append([]byte{}, t.fingerprint...), t.srsHash...))
+	if err != nil {
+		return int64(n + m), err
+	}
+
+	enc := curve.NewEncoder(w)
+	if err = enc.Encode(&t.delta1); err == nil {
+		if err = enc.Encode(&t.delta2); err == nil {
+			for i := range t.contributions {
+				if err = t.contributions[i].writeTo(enc); err != nil {
+					break
+				}
+			}
+		}
+	}
+	return int64(n+m) + enc.BytesWritten(), err
+}
+
+func (c *contribution) writeTo(enc *curve.Encoder) error {
+	for _, v := range []interface{}{&c.delta1, &c.delta2, &c.s, &c.sd, &c.rd} {
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readTranscript(path string) (*transcript, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	header := make([]byte, len(transcriptDomain)+2*sha256.Size)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:len(transcriptDomain)]) != transcriptDomain {
+		return nil, ErrInvalidProof
+	}
+
+	t := &transcript{
+		fingerprint: header[len(transcriptDomain) : len(transcriptDomain)+sha256.Size],
+		srsHash:     header[len(transcriptDomain)+sha256.Size:],
+	}
+	dec := curve.NewDecoder(r)
+	if err = dec.Decode(&t.delta1); err != nil {
+		return nil, err
+	}
+	if err = dec.Decode(&t.delta2); err != nil {
+		return nil, err
+	}
+	for {
+		if _, err = r.Peek(1); err == io.EOF {
+			return t, nil
+		}
+		var c contribution
+		for _, v := range []interface{}{&c.delta1, &c.delta2, &c.s, &c.sd, &c.rd} {
+			if err = dec.Decode(v); err != nil {
+				return nil, err
+			}
+		}
+		t.contributions = append(t.contributions, c)
+	}
+}
+
+// lock takes the lock of the ceremony in dir, so that a single participant updates it
+// at a time, and returns its release.
+func lock(dir string) (func(), error) {
+	f, err := os.OpenFile(filepath.Join(dir, lockFile), os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, ErrBusy
+		}
+		return nil, err
+	}
+	f.Close()
+	return func() { os.Remove(f.Name()) }, nil
+}
+
+// writeFile replaces the content of path with object, atomically.
+func writeFile(path string, object io.WriterTo) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	if _, err = object.WriteTo(w); err == nil {
+		if err = w.Flush(); err == nil {
+			err = f.Sync()
+		}
+	}
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func pairingCheck(p []curve.G1Affine, q []curve.G2Affine) error {
+	ok, err := curve.PairingCheck(p, q)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+func scale(points []curve.G1Affine, s *big.Int) {
+	for i := range points {
+		points[i].ScalarMultiplication(&points[i], s)
+	}
+}
+
+func toBigInt(e *fr.Element) *big.Int {
+	var b big.Int
+	e.ToBigIntRegular(&b)
+	return &b
+}
@@ -0,0 +1,249 @@
+package ceremony
+
+import (
+	"blockchain_DP/prover"
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+)
+
+type sumCircuit struct {
+	X   []frontend.Variable
+	Sum frontend.Variable `gnark:",public"`
+}
+
+func (circuit *sumCircuit) Define(api frontend.API) error {
+	var sum frontend.Variable = 0
+	for i := range circuit.X {
+		sum = api.Add(sum, api.Mul(circuit.X[i], circuit.X[i]))
+	}
+	api.AssertIsEqual(sum, circuit.Sum)
+	return nil
+}
+
+func newSumCircuit(n int) *sumCircuit {
+	return &sumCircuit{X: make([]frontend.Variable, n)}
+}
+
+func TestCeremony(t *testing.T) {
+	assert := test.NewAssert(t)
+	dir := t.TempDir()
+	out := t.TempDir()
+
+	assert.NoError(Init(dir, newSumCircuit(3)))
+	assert.ErrorIs(Init(dir, newSumCircuit(3)), ErrExists)
+	assert.ErrorIs(StartPhase2(dir, newSumCircuit(3)), ErrNoContributions)
+	assert.ErrorIs(Finalize(dir, out, newSumCircuit(3)), ErrPhase1)
+
+	// participants contribute one after the other to the powers of tau
+	var hashes [][]byte
+	for i := 0; i < 2; i++ {
+		hash, err := Contribute(dir)
+		assert.NoError(err)
+		hashes = append(hashes, hash)
+	}
+
+	assert.NoError(StartPhase2(dir, newSumCircuit(3)))
+	assert.ErrorIs(StartPhase2(dir, newSumCircuit(3)), ErrPhase2)
+	assert.ErrorIs(Finalize(dir, out, newSumCircuit(3)), ErrNoContributions)
+
+	// then to delta
+	for i := 0; i < 3; i++ {
+		hash, err := Contribute(dir)
+		assert.NoError(err)
+		hashes = append(hashes, hash)
+	}
+
+	verified, err := Verify(dir, newSumCircuit(3))
+	assert.NoError(err)
+	assert.Equal(hashes, verified)
+
+	_, err = Verify(dir, newSumCircuit(2))
+	assert.ErrorIs(err, prover.ErrFingerprintMismatch)
+
+	// the final keys prove and verify
+	assert.NoError(Finalize(dir, out, newSumCircuit(3)))
+	keys, err := prover.ReadKeys(out, newSumCircuit(3))
+	assert.NoError(err)
+
+	assignment := &sumCircuit{X: []frontend.Variable{1, 2, 3}, Sum: 14}
+	proof, err := prover.Prove(keys, assignment)
+	assert.NoError(err)
+	publicWitness, err := prover.PublicWitness(assignment)
+	assert.NoError(err)
+	assert.NoError(prover.Verify(keys.VK, proof, publicWitness))
+
+	// whereas proofs made with the keys derived from the powers of tau do not
+	_, _, _, initial, err := verifyPhase1(dir, newSumCircuit(3))
+	assert.NoError(err)
+	pk, _, err := initial.groth16()
+	assert.NoError(err)
+	proof, err = prover.Prove(&prover.Keys{CCS: keys.CCS, PK: pk, VK: keys.VK}, assignment)
+	assert.NoError(err)
+	assert.Error(prover.Verify(keys.VK, proof, publicWitness))
+}
+
+func TestConcurrentContributions(t *testing.T) {
+	assert := test.NewAssert(t)
+	dir := t.TempDir()
+
+	assert.NoError(Init(dir, newSumCircuit(2)))
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = Contribute(dir)
+		}(i)
+	}
+	wg.Wait()
+
+	accepted := 0
+	for _, err := range errs {
+		if err == nil {
+			accepted++
+		} else {
+			assert.ErrorIs(err, ErrBusy)
+		}
+	}
+
+	hashes, err := Verify(dir, newSumCircuit(2))
+	assert.NoError(err)
+	assert.Equal(accepted, len(hashes))
+}
+
+func TestCeremonyTampering(t *testing.T) {
+	assert := test.NewAssert(t)
+	dir := t.TempDir()
+
+	assert.NoError(Init(dir, newSumCircuit(2)))
+	for i := 0; i < 2; i++ {
+		_, err := Contribute(dir)
+		assert.NoError(err)
+	}
+
+	// powers of tau which are not powers of the same tau are rejected
+	path := filepath.Join(dir, srsFile)
+	original, err := os.ReadFile(path)
+	assert.NoError(err)
+	s, err := readSRS(path)
+	assert.NoError(err)
+	s.tau1[2] = s.tau1[3]
+	assert.NoError(writeFile(path, s))
+	_, err = Verify(dir, newSumCircuit(2))
+	assert.ErrorIs(err, ErrInvalidKeys)
+	assert.NoError(os.WriteFile(path, original, 0o644))
+
+	// so is a contribution to phase 1 without the knowledge of its update
+	path = filepath.Join(dir, srsTranscriptFile)
+	srsTranscript, err := readSRSTranscript(path)
+	assert.NoError(err)
+	srsTranscript.contributions[0].alpha.rx = srsTranscript.contributions[1].alpha.rx
+	original, err = os.ReadFile(path)
+	assert.NoError(err)
+	assert.NoError(writeFile(path, srsTranscript))
+	_, err = Verify(dir, newSumCircuit(2))
+	assert.ErrorIs(err, ErrInvalidProof)
+	assert.NoError(os.WriteFile(path, original, 0o644))
+
+	assert.NoError(StartPhase2(dir, newSumCircuit(2)))
+	for i := 0; i < 2; i++ {
+		_, err := Contribute(dir)
+		assert.NoError(err)
+	}
+
+	// a contribution to phase 2 without the knowledge of its update is rejected
+	path = filepath.Join(dir, transcriptFile)
+	transcript, err := readTranscript(path)
+	assert.NoError(err)
+	tampered, err := readTranscript(path)
+	assert.NoError(err)
+	tampered.contributions[0].rd = tampered.contributions[1].rd
+	assert.NoError(writeFile(path, tampered))
+	_, err = Verify(dir, newSumCircuit(2))
+	assert.ErrorIs(err, ErrInvalidProof)
+
+	// so is a transcript dropping a contribution
+	tampered, err = readTranscript(path)
+	assert.NoError(err)
+	tampered.contributions = transcript.contributions[1:]
+	assert.NoError(writeFile(path, tampered))
+	_, err = Verify(dir, newSumCircuit(2))
+	assert.ErrorIs(err, ErrInvalidProof)
+
+	// and keys not resulting from the transcript
+	assert.NoError(writeFile(path, transcript))
+	_, err = Verify(dir, newSumCircuit(2))
+	assert.NoError(err)
+
+	keys, err := readKeyPair(filepath.Join(dir, phase2File))
+	assert.NoError(err)
+	keys.pk.z[0] = keys.pk.z[1]
+	assert.NoError(writeFile(filepath.Join(dir, phase2File), keys))
+	_, err = Verify(dir, newSumCircuit(2))
+	assert.ErrorIs(err, ErrInvalidKeys)
+	_, err = Contribute(dir)
+	assert.NoError(err, "contributing does not verify the whole ceremony")
+
+	_, _, _, initial, err := verifyPhase1(dir, newSumCircuit(2))
+	assert.NoError(err)
+	assert.NoError(writeFile(filepath.Join(dir, phase2File), initial))
+	_, err = Contribute(dir)
+	assert.ErrorIs(err, ErrInvalidKeys)
+}
+
+// TestKeysFormat checks that keyPair (de)serializes the keys as gnark does, so that an
+// upgrade of gnark changing its format breaks the test rather than the ceremony.
+func TestKeysFormat(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	ccs, err := prover.Compile(newSumCircuit(3))
+	assert.NoError(err)
+	setup, err := prover.Setup(ccs)
+	assert.NoError(err)
+	pk, vk := setup.PK.(groth16.ProvingKey), setup.VK.(groth16.VerifyingKey)
+
+	keys, err := newKeyPair(pk, vk)
+	assert.NoError(err)
+	var written, raw bytes.Buffer
+	_, err = keys.WriteTo(&written)
+	assert.NoError(err)
+	_, err = pk.WriteRawTo(&raw)
+	assert.NoError(err)
+	_, err = vk.WriteRawTo(&raw)
+	assert.NoError(err)
+	assert.Equal(raw.Bytes(), written.Bytes())
+
+	readPK, readVK, err := keys.groth16()
+	assert.NoError(err)
+	assert.False(pk.IsDifferent(readPK))
+	assert.False(vk.IsDifferent(readVK))
+
+	// the keys derived from the powers of tau have the layout of those of groth16.Setup
+	s := newSRS(int(ccs.GetNbConstraints()))
+	var tau, alpha, beta fr.Element
+	for _, e := range []*fr.Element{&tau, &alpha, &beta} {
+		_, err = e.SetRandom()
+		assert.NoError(err)
+	}
+	s.update(&tau, &alpha, &beta)
+	derived, err := s.keys(ccs)
+	assert.NoError(err)
+	assert.Equal(len(keys.pk.a), len(derived.pk.a))
+	assert.Equal(len(keys.pk.b), len(derived.pk.b))
+	assert.Equal(len(keys.pk.b2), len(derived.pk.b2))
+	assert.Equal(len(keys.pk.z), len(derived.pk.z))
+	assert.Equal(len(keys.pk.k), len(derived.pk.k))
+	assert.Equal(len(keys.vk.k), len(derived.vk.k))
+	assert.Equal(keys.pk.infinityA, derived.pk.infinityA)
+	assert.Equal(keys.pk.infinityB, derived.pk.infinityB)
+}
@@ -0,0 +1,244 @@
+package ceremony
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+
+	curve "github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/fft"
+	"github.com/consensys/gnark/backend/groth16"
+)
+
+// keyPair is the content of the groth16 proving and verifying keys of gnark (bn254).
+// It is (de)serialized in the same order as gnark so that the keys can be read back
+// with groth16.ProvingKey.ReadFrom and groth16.VerifyingKey.ReadFrom.
+type keyPair struct {
+	pk struct {
+		domain fft.Domain
+
+		alpha1, beta1, delta1 curve.G1Affine
+		a, b, z, k            []curve.G1Affine
+		beta2, delta2         curve.G2Affine
+		b2                    []curve.G2Affine
+
+		nbInfinityA, nbInfinityB uint64
+		infinityA, infinityB     []bool
+	}
+	vk struct {
+		alpha1, beta1, delta1 curve.G1Affine
+		beta2, gamma2, delta2 curve.G2Affine
+		k                     []curve.G1Affine
+	}
+}
+
+func newKeyPair(pk, vk io.WriterTo) (*keyPair, error) {
+	var buf bytes.Buffer
+	if _, err := pk.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	if _, err := vk.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+
+	keys := new(keyPair)
+	if _, err := keys.ReadFrom(&buf); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// groth16 returns the gnark keys.
+func (keys *keyPair) groth16() (groth16.ProvingKey, groth16.VerifyingKey, error) {
+	var buf bytes.Buffer
+	if _, err := keys.WriteTo(&buf); err != nil {
+		return nil, nil, err
+	}
+
+	pk := groth16.NewProvingKey(curve.ID)
+	if _, err := pk.ReadFrom(&buf); err != nil {
+		return nil, nil, err
+	}
+	vk := groth16.NewVerifyingKey(curve.ID)
+	if _, err := vk.ReadFrom(&buf); err != nil {
+		return nil, nil, err
+	}
+	return pk, vk, nil
+}
+
+// WriteTo writes the proving key followed by the verifying key, with points uncompressed.
+func (keys *keyPair) WriteTo(w io.Writer) (int64, error) {
+	n, err := keys.pk.domain.WriteTo(w)
+	if err != nil {
+		return n, err
+	}
+
+	enc := curve.NewEncoder(w, curve.RawEncoding())
+	toEncode := []interface{}{
+		&keys.pk.alpha1,
+		&keys.pk.beta1,
+		&keys.pk.delta1,
+		keys.pk.a,
+		keys.pk.b,
+		keys.pk.z,
+		keys.pk.k,
+		&keys.pk.beta2,
+		&keys.pk.delta2,
+		keys.pk.b2,
+		uint64(len(keys.pk.infinityA)),
+		keys.pk.nbInfinityA,
+		keys.pk.nbInfinityB,
+		keys.pk.infinityA,
+		keys.pk.infinityB,
+
+		&keys.vk.alpha1,
+		&keys.vk.beta1,
+		&keys.vk.beta2,
+		&keys.vk.gamma2,
+		&keys.vk.delta1,
+		&keys.vk.delta2,
+		keys.vk.k,
+	}
+	for _, v := range toEncode {
+		if err := enc.Encode(v); err != nil {
+			return n + enc.BytesWritten(), err
+		}
+	}
+
+	return n + enc.BytesWritten(), nil
+}
+
+// ReadFrom reads keys written by WriteTo (or by the WriteTo methods of the gnark keys).
+func (keys *keyPair) ReadFrom(r io.Reader) (int64, error) {
+	n, err := keys.pk.domain.ReadFrom(r)
+	if err != nil {
+		return n, err
+	}
+
+	dec := curve.NewDecoder(r)
+	var nbWires uint64
+	toDecode := []interface{}{
+		&keys.pk.alpha1,
+		&keys.pk.beta1,
+		&keys.pk.delta1,
+		&keys.pk.a,
+		&keys.pk.b,
+		&keys.pk.z,
+		&keys.pk.k,
+		&keys.pk.beta2,
+		&keys.pk.delta2,
+		&keys.pk.b2,
+		&nbWires,
+		&keys.pk.nbInfinityA,
+		&keys.pk.nbInfinityB,
+	}
+	for _, v := range toDecode {
+		if err := dec.Decode(v); err != nil {
+			return n + dec.BytesRead(), err
+		}
+	}
+
+	keys.pk.infinityA = make([]bool, nbWires)
+	keys.pk.infinityB = make([]bool, nbWires)
+	toDecode = []interface{}{
+		&keys.pk.infinityA,
+		&keys.pk.infinityB,
+
+		&keys.vk.alpha1,
+		&keys.vk.beta1,
+		&keys.vk.beta2,
+		&keys.vk.gamma2,
+		&keys.vk.delta1,
+		&keys.vk.delta2,
+		&keys.vk.k,
+	}
+	for _, v := range toDecode {
+		if err := dec.Decode(v); err != nil {
+			return n + dec.BytesRead(), err
+		}
+	}
+
+	return n + dec.BytesRead(), nil
+}
+
+// sameSRS reports whether the two key pairs only differ by delta, i.e. by the
+// phase-2 contributions.
+func (keys *keyPair) sameSRS(other *keyPair) bool {
+	var d1, d2 bytes.Buffer
+	if _, err := keys.pk.domain.WriteTo(&d1); err != nil {
+		return false
+	}
+	if _, err := other.pk.domain.WriteTo(&d2); err != nil {
+		return false
+	}
+
+	return bytes.Equal(d1.Bytes(), d2.Bytes()) &&
+		keys.pk.alpha1.Equal(&other.pk.alpha1) &&
+		keys.pk.beta1.Equal(&other.pk.beta1) &&
+		equalG1(keys.pk.a, other.pk.a) &&
+		equalG1(keys.pk.b, other.pk.b) &&
+		len(keys.pk.z) == len(other.pk.z) &&
+		len(keys.pk.k) == len(other.pk.k) &&
+		keys.pk.beta2.Equal(&other.pk.beta2) &&
+		equalG2(keys.pk.b2, other.pk.b2) &&
+		keys.pk.nbInfinityA == other.pk.nbInfinityA &&
+		keys.pk.nbInfinityB == other.pk.nbInfinityB &&
+		equalBool(keys.pk.infinityA, other.pk.infinityA) &&
+		equalBool(keys.pk.infinityB, other.pk.infinityB) &&
+		keys.vk.alpha1.Equal(&other.vk.alpha1) &&
+		keys.vk.beta1.Equal(&other.vk.beta1) &&
+		keys.vk.beta2.Equal(&other.vk.beta2) &&
+		keys.vk.gamma2.Equal(&other.vk.gamma2) &&
+		equalG1(keys.vk.k, other.vk.k)
+}
+
+func readKeyPair(path string) (*keyPair, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	keys := new(keyPair)
+	if _, err = keys.ReadFrom(bufio.NewReader(f)); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func equalG1(a, b []curve.G1Affine) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(&b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalG2(a, b []curve.G2Affine) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(&b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalBool(a, b []bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,658 @@
+package ceremony
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"math/bits"
+	"os"
+	"reflect"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	curve "github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/fft"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/compiled"
+)
+
+const srsDomain = "ZKAT-VDP/ceremony/phase1"
+
+var (
+	ErrSRSSize = errors.New("powers of tau too short for the circuit")
+	ErrBackend = errors.New("not a groth16 constraint system over bn254")
+)
+
+// srs is the output of phase 1, the powers of tau for domains of up to n elements:
+// [τ^i]1 for i < 2n, [ατ^i]1, [βτ^i]1 and [τ^i]2 for i < n, and [β]2. It does not
+// depend on the circuit.
+type srs struct {
+	tau1      []curve.G1Affine
+	alphaTau1 []curve.G1Affine
+	betaTau1  []curve.G1Affine
+	tau2      []curve.G2Affine
+	beta2     curve.G2Affine
+}
+
+// srsHead is [τ]1, [α]1, [β]1, [τ]2 and [β]2, the part of the powers of tau which the
+// transcript of phase 1 follows.
+type srsHead struct {
+	tau1, alpha1, beta1 curve.G1Affine
+	tau2, beta2         curve.G2Affine
+}
+
+// knowledge is a proof of knowledge of the update x of a point: [s]1, [s*x]1 and [x]R
+// where R is derived from the transcript so far, [s]1 and [s*x]1.
+type knowledge struct {
+	s, sx curve.G1Affine
+	rx    curve.G2Affine
+}
+
+// srsContribution is a transcript entry of phase 1: the new head of the powers of tau,
+// and the proofs of knowledge of the updates of τ, α and β.
+type srsContribution struct {
+	srsHead
+	tau, alpha, beta knowledge
+}
+
+// srsTranscript is the header (circuit fingerprint and size of the powers of tau)
+// followed by the contributions of phase 1, starting from τ = α = β = 1. Its hash after
+// each contribution identifies that contribution.
+type srsTranscript struct {
+	fingerprint   []byte
+	size          uint64
+	contributions []srsContribution
+}
+
+// newSRS returns the powers of tau for domains of up to n elements with τ = α = β = 1,
+// which every participant can recompute: no one knows more about them than anyone else.
+func newSRS(n int) *srs {
+	_, _, g1, g2 := curve.Generators()
+	s := &srs{
+		tau1:      make([]curve.G1Affine, 2*n),
+		alphaTau1: make([]curve.G1Affine, n),
+		betaTau1:  make([]curve.G1Affine, n),
+		tau2:      make([]curve.G2Affine, n),
+		beta2:     g2,
+	}
+	for _, points := range [][]curve.G1Affine{s.tau1, s.alphaTau1, s.betaTau1} {
+		for i := range points {
+			points[i] = g1
+		}
+	}
+	for i := range s.tau2 {
+		s.tau2[i] = g2
+	}
+	return s
+}
+
+// head returns the head of the powers of tau.
+func (s *srs) head() srsHead {
+	return srsHead{tau1: s.tau1[1], alpha1: s.alphaTau1[0], beta1: s.betaTau1[0], tau2: s.tau2[1], beta2: s.beta2}
+}
+
+// update multiplies τ, α and β by tau, alpha and beta.
+func (s *srs) update(tau, alpha, beta *fr.Element) {
+	var power, alphaPower, betaPower fr.Element
+	power.SetOne()
+	for i := range s.tau1 {
+		s.tau1[i].ScalarMultiplication(&s.tau1[i], toBigInt(&power))
+		if i < len(s.tau2) {
+			alphaPower.Mul(&power, alpha)
+			betaPower.Mul(&power, beta)
+			s.alphaTau1[i].ScalarMultiplication(&s.alphaTau1[i], toBigInt(&alphaPower))
+			s.betaTau1[i].ScalarMultiplication(&s.betaTau1[i], toBigInt(&betaPower))
+			s.tau2[i].ScalarMultiplication(&s.tau2[i], toBigInt(&power))
+		}
+		power.Mul(&power, tau)
+	}
+	s.beta2.ScalarMultiplication(&s.beta2, toBigInt(beta))
+}
+
+// verify checks that s are powers of the τ, α and β of head, with random linear
+// combinations of e(P_i+1, g2) = e(P_i, [τ]2) and e(g1, Q_i+1) = e([τ]1, Q_i).
+func (s *srs) verify(size uint64, head *srsHead) error {
+	n := len(s.tau2)
+	if uint64(n) != size || n < 2 || len(s.tau1) != 2*n || len(s.alphaTau1) != n || len(s.betaTau1) != n {
+		return ErrInvalidKeys
+	}
+	_, _, g1, g2 := curve.Generators()
+	if !s.tau1[0].Equal(&g1) || !s.tau2[0].Equal(&g2) || s.head() != *head {
+		return ErrInvalidKeys
+	}
+
+	rho := make([]fr.Element, len(s.tau1)-1)
+	for i := range rho {
+		if _, err := rho[i].SetRandom(); err != nil {
+			return err
+		}
+	}
+	config := ecc.MultiExpConfig{ScalarsMont: true}
+	for _, points := range [][]curve.G1Affine{s.tau1, s.alphaTau1, s.betaTau1} {
+		var next, prev curve.G1Affine
+		if _, err := next.MultiExp(points[1:], rho[:len(points)-1], config); err != nil {
+			return err
+		}
+		if _, err := prev.MultiExp(points[:len(points)-1], rho[:len(points)-1], config); err != nil {
+			return err
+		}
+		prev.Neg(&prev)
+		if err := pairingCheck([]curve.G1Affine{next, prev}, []curve.G2Affine{g2, head.tau2}); err != nil {
+			return ErrInvalidKeys
+		}
+	}
+
+	var next, prev curve.G2Affine
+	if _, err := next.MultiExp(s.tau2[1:], rho[:n-1], config); err != nil {
+		return err
+	}
+	if _, err := prev.MultiExp(s.tau2[:n-1], rho[:n-1], config); err != nil {
+		return err
+	}
+	var tau1Neg curve.G1Affine
+	tau1Neg.Neg(&head.tau1)
+	if err := pairingCheck([]curve.G1Affine{g1, tau1Neg}, []curve.G2Affine{next, prev}); err != nil {
+		return ErrInvalidKeys
+	}
+	return nil
+}
+
+// keys derives the groth16 keys of ccs from the powers of tau, with γ = δ = 1: phase 2
+// then updates δ. The keys are those groth16.Setup would compute for the same τ, α
+// and β.
+func (s *srs) keys(ccs frontend.CompiledConstraintSystem) (*keyPair, error) {
+	r1cs, coefficients, err := constraintSystem(ccs)
+	if err != nil {
+		return nil, err
+	}
+	domain := fft.NewDomain(uint64(len(r1cs.Constraints)))
+	n := int(domain.Cardinality)
+	if n > len(s.tau2) {
+		return nil, ErrSRSSize
+	}
+
+	// [L_j(τ)], [αL_j(τ)] and [βL_j(τ)] for the Lagrange basis of the domain
+	lagrange1 := lagrangeG1(s.tau1[:n], domain)
+	alphaLagrange1 := lagrangeG1(s.alphaTau1[:n], domain)
+	betaLagrange1 := lagrangeG1(s.betaTau1[:n], domain)
+	lagrange2 := lagrangeG2(s.tau2[:n], domain)
+
+	// A_i, B_i and βA_i+αB_i+C_i at τ, for each wire i
+	nbWires := r1cs.NbInternalVariables + r1cs.NbPublicVariables + r1cs.NbSecretVariables
+	a := make([]curve.G1Jac, nbWires)
+	b := make([]curve.G1Jac, nbWires)
+	b2 := make([]curve.G2Jac, nbWires)
+	k := make([]curve.G1Jac, nbWires)
+	for j, c := range r1cs.Constraints {
+		for _, t := range c.L {
+			addTermG1(&a[t.WireID()], t, coefficients, &lagrange1[j])
+			addTermG1(&k[t.WireID()], t, coefficients, &betaLagrange1[j])
+		}
+		for _, t := range c.R {
+			addTermG1(&b[t.WireID()], t, coefficients, &lagrange1[j])
+			addTermG2(&b2[t.WireID()], t, coefficients, &lagrange2[j])
+			addTermG1(&k[t.WireID()], t, coefficients, &alphaLagrange1[j])
+		}
+		for _, t := range c.O {
+			addTermG1(&k[t.WireID()], t, coefficients, &lagrange1[j])
+		}
+	}
+
+	keys := new(keyPair)
+	_, _, g1, g2 := curve.Generators()
+	keys.pk.domain = *domain
+	keys.pk.alpha1, keys.pk.beta1, keys.pk.delta1 = s.alphaTau1[0], s.betaTau1[0], g1
+	keys.pk.beta2, keys.pk.delta2 = s.beta2, g2
+
+	// points at infinity are filtered out of A and B, as by groth16.Setup
+	aAffine := make([]curve.G1Affine, nbWires)
+	bAffine := make([]curve.G1Affine, nbWires)
+	curve.BatchJacobianToAffineG1(a, aAffine)
+	curve.BatchJacobianToAffineG1(b, bAffine)
+	keys.pk.infinityA = make([]bool, nbWires)
+	keys.pk.infinityB = make([]bool, nbWires)
+	for i := 0; i < nbWires; i++ {
+		if aAffine[i].IsInfinity() {
+			keys.pk.infinityA[i] = true
+			keys.pk.nbInfinityA++
+		} else {
+			keys.pk.a = append(keys.pk.a, aAffine[i])
+		}
+		if bAffine[i].IsInfinity() {
+			keys.pk.infinityB[i] = true
+			keys.pk.nbInfinityB++
+		} else {
+			var p curve.G2Affine
+			keys.pk.b = append(keys.pk.b, bAffine[i])
+			keys.pk.b2 = append(keys.pk.b2, *p.FromJacobian(&b2[i]))
+		}
+	}
+
+	kAffine := make([]curve.G1Affine, nbWires)
+	curve.BatchJacobianToAffineG1(k, kAffine)
+	keys.pk.k = kAffine[r1cs.NbPublicVariables:]
+
+	// [τ^i(τ^n-1)]1, in bit-reversed order
+	keys.pk.z = make([]curve.G1Affine, n)
+	for i := range keys.pk.z {
+		keys.pk.z[i].Sub(&s.tau1[i+n], &s.tau1[i])
+	}
+	bitReverse(keys.pk.z)
+
+	keys.vk.alpha1, keys.vk.beta1, keys.vk.delta1 = keys.pk.alpha1, keys.pk.beta1, g1
+	keys.vk.beta2, keys.vk.gamma2, keys.vk.delta2 = s.beta2, g2, g2
+	keys.vk.k = kAffine[:r1cs.NbPublicVariables]
+
+	return keys, nil
+}
+
+// constraintSystem returns the constraints of ccs and their coefficients. gnark keeps
+// its groth16 constraint system of bn254 internal: its exported fields are read by
+// reflection.
+func constraintSystem(ccs frontend.CompiledConstraintSystem) (*compiled.R1CS, []fr.Element, error) {
+	v := reflect.ValueOf(ccs)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct || ccs.CurveID() != ecc.BN254 {
+		return nil, nil, ErrBackend
+	}
+	r1csField, coefficientsField := v.Elem().FieldByName("R1CS"), v.Elem().FieldByName("Coefficients")
+	if !r1csField.IsValid() || !coefficientsField.IsValid() {
+		return nil, nil, ErrBackend
+	}
+	r1cs, ok := r1csField.Interface().(compiled.R1CS)
+	if !ok {
+		return nil, nil, ErrBackend
+	}
+	coefficients, ok := coefficientsField.Interface().([]fr.Element)
+	if !ok {
+		return nil, nil, ErrBackend
+	}
+	return &r1cs, coefficients, nil
+}
+
+// coefficient returns the coefficient of t, nil for 1.
+func coefficient(t compiled.Term, coefficients []fr.Element) *big.Int {
+	switch t.CoeffID() {
+	case compiled.CoeffIdOne:
+		return nil
+	case compiled.CoeffIdMinusOne:
+		var minusOne fr.Element
+		minusOne.SetOne().Neg(&minusOne)
+		return toBigInt(&minusOne)
+	default:
+		return toBigInt(&coefficients[t.CoeffID()])
+	}
+}
+
+// addTermG1 adds the coefficient of t times p to res.
+func addTermG1(res *curve.G1Jac, t compiled.Term, coefficients []fr.Element, p *curve.G1Affine) {
+	if t.CoeffID() == compiled.CoeffIdZero {
+		return
+	}
+	c := coefficient(t, coefficients)
+	if c == nil {
+		res.AddMixed(p)
+		return
+	}
+	var q curve.G1Affine
+	q.ScalarMultiplication(p, c)
+	res.AddMixed(&q)
+}
+
+// addTermG2 adds the coefficient of t times p to res.
+func addTermG2(res *curve.G2Jac, t compiled.Term, coefficients []fr.Element, p *curve.G2Affine) {
+	if t.CoeffID() == compiled.CoeffIdZero {
+		return
+	}
+	c := coefficient(t, coefficients)
+	if c == nil {
+		res.AddMixed(p)
+		return
+	}
+	var q curve.G2Affine
+	q.ScalarMultiplication(p, c)
+	res.AddMixed(&q)
+}
+
+// lagrangeG1 returns [L_j(τ)]1 for the Lagrange basis of domain from [τ^i]1, i < n,
+// by an inverse FFT: L_j(τ) = 1/n Σ_i ω^(-ij) τ^i.
+func lagrangeG1(powers []curve.G1Affine, domain *fft.Domain) []curve.G1Affine {
+	n := len(powers)
+	twiddles := inverseTwiddles(domain)
+	nInv := toBigInt(&domain.CardinalityInv)
+
+	a := make([]curve.G1Jac, n)
+	for i := range powers {
+		a[i].FromAffine(&powers[i])
+	}
+	bitReverseJacG1(a)
+	for m := 2; m <= n; m <<= 1 {
+		for k := 0; k < n; k += m {
+			for j := 0; j < m/2; j++ {
+				var t curve.G1Jac
+				t.ScalarMultiplication(&a[k+j+m/2], &twiddles[j*(n/m)])
+				a[k+j+m/2].Set(&a[k+j]).SubAssign(&t)
+				a[k+j].AddAssign(&t)
+			}
+		}
+	}
+	for i := range a {
+		a[i].ScalarMultiplication(&a[i], nInv)
+	}
+
+	res := make([]curve.G1Affine, n)
+	curve.BatchJacobianToAffineG1(a, res)
+	return res
+}
+
+// lagrangeG2 returns [L_j(τ)]2 for the Lagrange basis of domain from [τ^i]2, i < n.
+func lagrangeG2(powers []curve.G2Affine, domain *fft.Domain) []curve.G2Affine {
+	n := len(powers)
+	twiddles := inverseTwiddles(domain)
+	nInv := toBigInt(&domain.CardinalityInv)
+
+	a := make([]curve.G2Jac, n)
+	for i := range powers {
+		a[i].FromAffine(&powers[i])
+	}
+	bitReverseJacG2(a)
+	for m := 2; m <= n; m <<= 1 {
+		for k := 0; k < n; k += m {
+			for j := 0; j < m/2; j++ {
+				var t curve.G2Jac
+				t.ScalarMultiplication(&a[k+j+m/2], &twiddles[j*(n/m)])
+				a[k+j+m/2].Set(&a[k+j]).SubAssign(&t)
+				a[k+j].AddAssign(&t)
+			}
+		}
+	}
+
+	res := make([]curve.G2Affine, n)
+	for i := range a {
+		a[i].ScalarMultiplication(&a[i], nInv)
+		res[i].FromJacobian(&a[i])
+	}
+	return res
+}
+
+// inverseTwiddles returns ω^(-i) for i < n/2.
+func inverseTwiddles(domain *fft.Domain) []big.Int {
+	twiddles := make([]big.Int, domain.Cardinality/2)
+	w := fr.One()
+	for i := range twiddles {
+		w.ToBigIntRegular(&twiddles[i])
+		w.Mul(&w, &domain.GeneratorInv)
+	}
+	return twiddles
+}
+
+// bitReverse permutes a as groth16.Setup permutes the Z part of the proving key.
+func bitReverse(a []curve.G1Affine) {
+	n := uint(len(a))
+	nn := uint(bits.UintSize - bits.TrailingZeros(n))
+	for i := uint(0); i < n; i++ {
+		if irev := bits.Reverse(i) >> nn; irev > i {
+			a[i], a[irev] = a[irev], a[i]
+		}
+	}
+}
+
+func bitReverseJacG1(a []curve.G1Jac) {
+	n := uint(len(a))
+	nn := uint(bits.UintSize - bits.TrailingZeros(n))
+	for i := uint(0); i < n; i++ {
+		if irev := bits.Reverse(i) >> nn; irev > i {
+			a[i], a[irev] = a[irev], a[i]
+		}
+	}
+}
+
+func bitReverseJacG2(a []curve.G2Jac) {
+	n := uint(len(a))
+	nn := uint(bits.UintSize - bits.TrailingZeros(n))
+	for i := uint(0); i < n; i++ {
+		if irev := bits.Reverse(i) >> nn; irev > i {
+			a[i], a[irev] = a[irev], a[i]
+		}
+	}
+}
+
+func (s *srs) WriteTo(w io.Writer) (int64, error) {
+	enc := curve.NewEncoder(w, curve.RawEncoding())
+	for _, v := range []interface{}{s.tau1, s.alphaTau1, s.betaTau1, s.tau2, &s.beta2} {
+		if err := enc.Encode(v); err != nil {
+			return enc.BytesWritten(), err
+		}
+	}
+	return enc.BytesWritten(), nil
+}
+
+func (s *srs) ReadFrom(r io.Reader) (int64, error) {
+	dec := curve.NewDecoder(r)
+	for _, v := range []interface{}{&s.tau1, &s.alphaTau1, &s.betaTau1, &s.tau2, &s.beta2} {
+		if err := dec.Decode(v); err != nil {
+			return dec.BytesRead(), err
+		}
+	}
+	return dec.BytesRead(), nil
+}
+
+func readSRS(path string) (*srs, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := new(srs)
+	if _, err = s.ReadFrom(bufio.NewReader(f)); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// head returns the current head of the powers of tau.
+func (t *srsTranscript) head() srsHead {
+	if len(t.contributions) == 0 {
+		_, _, g1, g2 := curve.Generators()
+		return srsHead{tau1: g1, alpha1: g1, beta1: g1, tau2: g2, beta2: g2}
+	}
+	return t.contributions[len(t.contributions)-1].srsHead
+}
+
+// contribute updates s by random τ, α and β, and returns the contribution proving it.
+func (t *srsTranscript) contribute(s *srs) (*srsContribution, error) {
+	var tau, alpha, beta fr.Element
+	for _, x := range []*fr.Element{&tau, &alpha, &beta} {
+		for x.IsZero() {
+			if _, err := x.SetRandom(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	s.update(&tau, &alpha, &beta)
+
+	c := &srsContribution{srsHead: s.head()}
+	hashes := t.hashes()
+	var err error
+	if c.tau, err = proveKnowledge(hashes[len(hashes)-1], 't', &tau); err != nil {
+		return nil, err
+	}
+	if c.alpha, err = proveKnowledge(hashes[len(hashes)-1], 'a', &alpha); err != nil {
+		return nil, err
+	}
+	if c.beta, err = proveKnowledge(hashes[len(hashes)-1], 'b', &beta); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// verify checks every contribution of the transcript.
+func (t *srsTranscript) verify() error {
+	_, _, g1, g2 := curve.Generators()
+	var g1Neg curve.G1Affine
+	g1Neg.Neg(&g1)
+
+	hashes := t.hashes()
+	prev := (&srsTranscript{}).head()
+	for i := range t.contributions {
+		c := &t.contributions[i]
+		if err := c.tau.verify(hashes[i], 't', &prev.tau1, &c.tau1); err != nil {
+			return err
+		}
+		if err := c.alpha.verify(hashes[i], 'a', &prev.alpha1, &c.alpha1); err != nil {
+			return err
+		}
+		if err := c.beta.verify(hashes[i], 'b', &prev.beta1, &c.beta1); err != nil {
+			return err
+		}
+		// the points of G2 match those of G1: e(P, g2) = e(g1, Q)
+		if err := pairingCheck([]curve.G1Affine{c.tau1, g1Neg}, []curve.G2Affine{g2, c.tau2}); err != nil {
+			return err
+		}
+		if err := pairingCheck([]curve.G1Affine{c.beta1, g1Neg}, []curve.G2Affine{g2, c.beta2}); err != nil {
+			return err
+		}
+		prev = c.srsHead
+	}
+	return nil
+}
+
+// hashes returns the hash of the transcript header followed by the hash of the
+// transcript after each contribution.
+func (t *srsTranscript) hashes() [][]byte {
+	var buf bytes.Buffer
+	header := &srsTranscript{fingerprint: t.fingerprint, size: t.size}
+	header.WriteTo(&buf)
+	h := sha256.Sum256(buf.Bytes())
+	hashes := [][]byte{h[:]}
+
+	for i := range t.contributions {
+		buf.Reset()
+		buf.Write(hashes[i])
+		t.contributions[i].writeTo(curve.NewEncoder(&buf))
+		h := sha256.Sum256(buf.Bytes())
+		hashes = append(hashes, h[:])
+	}
+
+	return hashes
+}
+
+func (t *srsTranscript) WriteTo(w io.Writer) (int64, error) {
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], t.size)
+	var header []byte
+	header = append(header, srsDomain...)
+	header = append(header, t.fingerprint...)
+	header = append(header, size[:]...)
+	n, err := w.Write(header)
+	if err != nil {
+		return int64(n), err
+	}
+
+	enc := curve.NewEncoder(w)
+	for i := range t.contributions {
+		if err = t.contributions[i].writeTo(enc); err != nil {
+			break
+		}
+	}
+	return int64(n) + enc.BytesWritten(), err
+}
+
+func (c *srsContribution) fields() []interface{} {
+	return []interface{}{
+		&c.tau1, &c.alpha1, &c.beta1, &c.tau2, &c.beta2,
+		&c.tau.s, &c.tau.sx, &c.tau.rx,
+		&c.alpha.s, &c.alpha.sx, &c.alpha.rx,
+		&c.beta.s, &c.beta.sx, &c.beta.rx,
+	}
+}
+
+func (c *srsContribution) writeTo(enc *curve.Encoder) error {
+	for _, v := range c.fields() {
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readSRSTranscript(path string) (*srsTranscript, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	header := make([]byte, len(srsDomain)+sha256.Size+8)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:len(srsDomain)]) != srsDomain {
+		return nil, ErrInvalidProof
+	}
+
+	t := &srsTranscript{
+		fingerprint: header[len(srsDomain) : len(srsDomain)+sha256.Size],
+		size:        binary.BigEndian.Uint64(header[len(srsDomain)+sha256.Size:]),
+	}
+	dec := curve.NewDecoder(r)
+	for {
+		if _, err = r.Peek(1); err == io.EOF {
+			return t, nil
+		}
+		var c srsContribution
+		for _, v := range c.fields() {
+			if err = dec.Decode(v); err != nil {
+				return nil, err
+			}
+		}
+		t.contributions = append(t.contributions, c)
+	}
+}
+
+// proveKnowledge returns the proof of knowledge of x, labelled so that the updates of a
+// contribution have distinct challenges.
+func proveKnowledge(hash []byte, label byte, x *fr.Element) (knowledge, error) {
+	var k knowledge
+	var s fr.Element
+	for s.IsZero() {
+		if _, err := s.SetRandom(); err != nil {
+			return k, err
+		}
+	}
+	_, _, g1, _ := curve.Generators()
+	k.s.ScalarMultiplication(&g1, toBigInt(&s))
+	k.sx.ScalarMultiplication(&k.s, toBigInt(x))
+	r, err := challengeG2(append(append([]byte{}, hash...), label), srsDomain, &k.s, &k.sx)
+	if err != nil {
+		return k, err
+	}
+	k.rx.ScalarMultiplication(&r, toBigInt(x))
+	return k, nil
+}
+
+// verify checks the proof of knowledge of x, and that after = x*before.
+func (k *knowledge) verify(hash []byte, label byte, before, after *curve.G1Affine) error {
+	if k.s.IsInfinity() || k.sx.IsInfinity() || after.IsInfinity() {
+		return ErrInvalidProof
+	}
+	r, err := challengeG2(append(append([]byte{}, hash...), label), srsDomain, &k.s, &k.sx)
+	if err != nil {
+		return err
+	}
+
+	var sxNeg, afterNeg curve.G1Affine
+	sxNeg.Neg(&k.sx)
+	afterNeg.Neg(after)
+	// knowledge of x: e(s, [x]R) = e([s*x], R)
+	if err = pairingCheck([]curve.G1Affine{k.s, sxNeg}, []curve.G2Affine{k.rx, r}); err != nil {
+		return err
+	}
+	// before was multiplied by x: e(before, [x]R) = e(after, R)
+	return pairingCheck([]curve.G1Affine{*before, afterNeg}, []curve.G2Affine{k.rx, r})
+}
@@ -0,0 +1,107 @@
+// Command ceremony runs the ceremony of the keys of the xi and delta circuits in a
+// directory shared by the participants:
+//
+//	ceremony -circuit xi -inputs 4 -dir xi4 init
+//	ceremony -dir xi4 contribute          (phase 1, once per participant, in turn)
+//	ceremony -circuit xi -inputs 4 -dir xi4 phase2
+//	ceremony -dir xi4 contribute          (phase 2, once per participant, in turn)
+//	ceremony -circuit xi -inputs 4 -dir xi4 verify
+//	ceremony -circuit xi -inputs 4 -dir xi4 -out keys/xi4 finalize
+//
+// The keys are sound as long as one participant of each phase does not keep its
+// randomness.
+package main
+
+import (
+	"blockchain_DP/ceremony"
+	"blockchain_DP/deltacircuit"
+	"blockchain_DP/hashfunctions"
+	"blockchain_DP/xicircuit"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/consensys/gnark/frontend"
+)
+
+func main() {
+	dir := flag.String("dir", "ceremony", "directory of the ceremony")
+	out := flag.String("out", "keys", "directory the final keys are written to")
+	name := flag.String("circuit", "xi", "circuit: xi or delta")
+	inputs := flag.Int("inputs", 1, "number of inputs (notes spent, or a_pk)")
+	hashName := flag.String("hash", hashfunctions.MiMC.String(), "hash function: MiMC or Poseidon")
+	depth := flag.Int("depth", xicircuit.DefaultTreeDepth, "depth of the note commitment tree (xi circuit)")
+	registryDepth := flag.Int("registry", 0, "depth of the registry of the registration authority, 0 for signed address lists (delta circuit)")
+	idBits := flag.Int("idbits", 0, "size of the IDs reported bit by bit, 0 to report whole IDs (delta circuit)")
+	censusDepth := flag.Int("census", 0, "depth of the registry of census keys hiding the census key, 0 for a public key")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] init|contribute|phase2|verify|finalize\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	circuit, err := newCircuit(*name, *inputs, *hashName, *depth, *registryDepth, *idBits, *censusDepth)
+	if err != nil {
+		fail(err)
+	}
+
+	switch flag.Arg(0) {
+	case "init":
+		err = ceremony.Init(*dir, circuit)
+	case "contribute":
+		var hash []byte
+		if hash, err = ceremony.Contribute(*dir); err == nil {
+			fmt.Printf("contribution %x\n", hash)
+		}
+	case "phase2":
+		err = ceremony.StartPhase2(*dir, circuit)
+	case "verify":
+		var hashes [][]byte
+		if hashes, err = ceremony.Verify(*dir, circuit); err == nil {
+			for i, hash := range hashes {
+				fmt.Printf("contribution %d: %x\n", i+1, hash)
+			}
+		}
+	case "finalize":
+		err = ceremony.Finalize(*dir, *out, circuit)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+func newCircuit(name string, inputs int, hashName string, depth, registryDepth, idBits, censusDepth int) (frontend.Circuit, error) {
+	var h hashfunctions.HashID
+	switch {
+	case strings.EqualFold(hashName, hashfunctions.MiMC.String()):
+		h = hashfunctions.MiMC
+	case strings.EqualFold(hashName, hashfunctions.Poseidon.String()):
+		h = hashfunctions.Poseidon
+	default:
+		return nil, hashfunctions.ErrUnknownHash
+	}
+
+	switch name {
+	case "xi":
+		return xicircuit.NewXiCircuit(inputs, xicircuit.WithHash(h), xicircuit.WithTreeDepth(depth),
+			xicircuit.WithCensusRegistry(censusDepth)), nil
+	case "delta":
+		return deltacircuit.NewDeltaCircuit(inputs, deltacircuit.WithHash(h), deltacircuit.WithRegistry(registryDepth), deltacircuit.WithIDBits(idBits),
+			deltacircuit.WithCensusRegistry(censusDepth)), nil
+	default:
+		return nil, fmt.Errorf("unknown circuit %q", name)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "ceremony:", err)
+	os.Exit(1)
+}
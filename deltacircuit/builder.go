@@ -0,0 +1,122 @@
+package deltacircuit
+
+import (
+	"blockchain_DP/elgamal"
+	"blockchain_DP/hashfunctions"
+	"blockchain_DP/merkle"
+	"blockchain_DP/prover"
+	"blockchain_DP/registry"
+	"fmt"
+	"math/big"
+
+	fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	eddsabn254 "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+	"github.com/consensys/gnark-crypto/signature"
+	"github.com/consensys/gnark/backend/witness"
+)
+
+// DeltaWitnessInput holds the protocol objects of a report: xi from the xi witness of
+// the same transaction, the ID and its registration, and the census key. Build derives
+// the other values of the witness from them.
+type DeltaWitnessInput struct {
+	// xi, the randomness of its commitment and nu_2, as in the xi witness
+	Xi  fr.Element
+	RXi fr.Element
+	Nu  []byte
+
+	// The ID is reported bit by bit if IDBits is set
+	ID     *big.Int
+	IDBits int
+
+	CensusPK elgamal.PublicKey
+
+	// The census hidden in the registry of census keys, if CensusPath is set, and its
+	// signing key
+	CensusPath  merkle.Path
+	CensusRoot  fr.Element
+	CensusSigPK signature.PublicKey
+
+	// The ID is registered in Registry under Apk if Registry is set, else by the
+	// signature of the registration authority over ApkList||ID
+	ApkList               []fr.Element
+	RegAuthorityPK        signature.PublicKey
+	RegAuthoritySignature []byte
+
+	Registry *registry.Registry
+	Apk      fr.Element
+}
+
+// RegistrationData computes H(apks||id), the data signed by the registration authority
+// to register apks to id.
+func RegistrationData(h hashfunctions.HashID, apks []fr.Element, id *big.Int) []byte {
+	hfunc := h.New()
+	for i := range apks {
+		hfunc.Write(apks[i].Marshal())
+	}
+	hfunc.Write(id.Bytes())
+	return hfunc.Sum(nil)
+}
+
+// Build returns the witness of the report: the commitment to xi and the LDP of the ID
+// are computed, and the LDP is encrypted under the census key with fresh randomness.
+func (in *DeltaWitnessInput) Build(h hashfunctions.HashID) (*Witness, error) {
+	if err := h.Check(); err != nil {
+		return nil, err
+	}
+
+	var w Witness
+	w.Xi, w.RXi = in.Xi, in.RXi
+	w.CMXi = h.Commit(w.RXi, w.Xi)
+	w.Nu = in.Nu
+
+	w.ID = in.ID
+	if err := w.SetReport(in.CensusPK, in.IDBits); err != nil {
+		return nil, err
+	}
+	w.CensusPath, w.CensusRoot = in.CensusPath, in.CensusRoot
+	if in.CensusPath.Siblings != nil {
+		var sigPK eddsabn254.PublicKey
+		if _, err := sigPK.SetBytes(in.CensusSigPK.Bytes()); err != nil {
+			return nil, fmt.Errorf("building delta witness: %w", err)
+		}
+		w.CensusSigPK = in.CensusSigPK
+		w.CensusBinding = registry.CensusBinding(h, registry.CensusLeaf(h, sigPK.A, in.CensusPK.A), w.Xi)
+	}
+
+	if in.Registry == nil {
+		w.ApkList = in.ApkList
+		w.RegAuthorityPK = in.RegAuthorityPK
+		w.RegAuthoritySignature = in.RegAuthoritySignature
+		return &w, nil
+	}
+
+	var err error
+	w.Apk = in.Apk
+	if w.RegistryPath, err = in.Registry.Path(in.Apk); err != nil {
+		return nil, fmt.Errorf("building delta witness: %w", err)
+	}
+	w.RegistryRoot = in.Registry.Root()
+	return &w, nil
+}
+
+// Assign builds the witness and returns its assignment and public witness.
+func (in *DeltaWitnessInput) Assign(h hashfunctions.HashID) (*DeltaCircuit, *witness.Witness, error) {
+	w, err := in.Build(h)
+	if err != nil {
+		return nil, nil, err
+	}
+	return w.AssignWithPublic()
+}
+
+// AssignWithPublic returns the assignment of the witness and its public witness.
+func (w *Witness) AssignWithPublic() (*DeltaCircuit, *witness.Witness, error) {
+	assignment, err := w.Assign()
+	if err != nil {
+		return nil, nil, err
+	}
+	public, err := prover.PublicWitness(assignment)
+	if err != nil {
+		return nil, nil, err
+	}
+	return assignment, public, nil
+}
@@ -2,88 +2,287 @@ package deltacircuit
 
 import (
 	//"crypto/subtle"
+	"blockchain_DP/hashfunctions"
+	"blockchain_DP/merkle"
+	"blockchain_DP/registry"
+	"fmt"
 
+	fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
 	tedwards "github.com/consensys/gnark-crypto/ecc/twistededwards"
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/std/algebra/twistededwards"
 	"github.com/consensys/gnark/std/math/bits"
 	eddsa "github.com/consensys/gnark/std/signature/eddsa"
-
-	"github.com/consensys/gnark/std/hash/mimc"
 )
 
 type Point struct {
 	X, Y frontend.Variable
 }
 
-type deltaCircuit struct {
+// MaxIDBits is the largest size of the IDs reported bit by bit: each bit uses two
+// coins of xi.
+const MaxIDBits = (fr.Bits - 1) / 2
+
+var ErrIDBits = fmt.Errorf("IDs reported bit by bit have at most %d bits", MaxIDBits)
+
+type config struct {
+	hashID        hashfunctions.HashID
+	registryDepth int
+	idBits        int
+	censusDepth   int
+}
+
+// Option configures the circuit returned by NewDeltaCircuit.
+type Option func(*config)
+
+// WithHash selects the hash function used by the commitments and signatures.
+func WithHash(h hashfunctions.HashID) Option {
+	return func(cfg *config) {
+		cfg.hashID = h
+	}
+}
+
+// WithRegistry registers the ID in the registry of the registration authority, a tree
+// of the given depth, instead of by a signature over all its addresses.
+func WithRegistry(depth int) Option {
+	return func(cfg *config) {
+		cfg.registryDepth = depth
+	}
+}
+
+// WithIDBits reports IDs of nbBits bits bit by bit: the LDP is applied to each bit,
+// which is encrypted on its own, so that the census only decrypts small values. The
+// ID is range checked. By default the LDP is applied to the whole ID.
+func WithIDBits(nbBits int) Option {
+	return func(cfg *config) {
+		cfg.idBits = nbBits
+	}
+}
+
+// WithCensusRegistry hides the census key in the published registry of census keys, a
+// tree of the given depth, instead of making it public, so that the report does not
+// reveal which census it is encrypted to. The signing key of the census is opened from
+// the same leaf, and the census is bound to xi for the xi proof.
+func WithCensusRegistry(depth int) Option {
+	return func(cfg *config) {
+		cfg.censusDepth = depth
+	}
+}
+
+// DeltaCircuit proves that (K, Delta) encrypts, under the census key, the LDP of an ID
+// registered by the registration authority, using the coins of the committed xi.
+type DeltaCircuit struct {
+	Xi   frontend.Variable
+	RXi  frontend.Variable
+	CMXi frontend.Variable `gnark:",public"`
 
-	// Random value agreed upon with the census
-	Coin0 frontend.Variable
-	Coin1 frontend.Variable
-	Xi    frontend.Variable
-	CMXi  frontend.Variable `gnark:",public"`
+	// nu_2 of the xi proof of the same transaction
+	Nu frontend.Variable `gnark:",public"`
+
+	Report Report
+}
+
+// Report proves that (K, Delta) encrypts, under the census key, the LDP of an ID
+// registered by the registration authority, using the coins of xi. It is the delta
+// circuit without the commitment to xi, so that it can be composed with the xi circuit.
+//
+// The ID is reported digit by digit: a single digit, the whole ID, or each of its bits
+// with WithIDBits. The i-th digit uses the coins 2i and 2i+1 of xi.
+type Report struct {
+
+	// Random value agreed upon with the census, for each digit
+	Coin0 []frontend.Variable
+	Coin1 []frontend.Variable
 
 	// private value hidden by LDP
 	ID     frontend.Variable
-	LDPVal frontend.Variable
-	Delta  Point `gnark:",public"` // Delta = Encrypt(LDP(ID,Xi))
+	LDPVal []frontend.Variable
+	K      []Point `gnark:",public"` // K_i = RNDscalar_i*Base
+	Delta  []Point `gnark:",public"` // Delta_i = Encrypt(LDP(ID_i,Xi))
 
 	curveID tedwards.ID
+	hashID  hashfunctions.HashID
+	idBits  int
 
 	// Variables used for the elgamal encryption
-	RNDscalar frontend.Variable
-	CensusPK  eddsa.PublicKey `gnark:",public"` // Public key of the census
+	RNDscalar []frontend.Variable
+
+	// The key of the census is either public (the default) or hidden in the registry of
+	// census keys (WithCensusRegistry): one of the two has a single element.
+	CensusPK       []eddsa.PublicKey `gnark:",public"`
+	CensusRegistry []registry.HiddenCensus
+
+	// The ID is registered either by a signature (the default) or in the registry
+	// (WithRegistry): one of the two has a single element, the other is empty and is
+	// not part of the circuit.
+	Signature []Signature
+	Registry  []Registry
+}
 
+// Signature registers an ID by a signature of the registration authority over ApkList||ID.
+type Signature struct {
 	ApkList               []frontend.Variable
 	RegAuthorityPK        eddsa.PublicKey `gnark:",public"`
 	RegAuthoritySignature eddsa.Signature
 }
 
+// Registry registers an ID by the membership of H(Apk||ID) in the registry of the
+// registration authority.
+type Registry struct {
+	Apk          frontend.Variable
+	RegistryPath merkle.CircuitPath
+	RegistryRoot frontend.Variable `gnark:",public"`
+}
+
+// NewDeltaCircuit returns the circuit for an ID registered with numApks addresses, to be
+// compiled. numApks is ignored with WithRegistry.
+func NewDeltaCircuit(numApks int, opts ...Option) *DeltaCircuit {
+	return &DeltaCircuit{Report: *NewReport(numApks, opts...)}
+}
+
+// NewReport returns the report of an ID registered with numApks addresses, to be
+// composed with another circuit. numApks is ignored with WithRegistry.
+func NewReport(numApks int, opts ...Option) *Report {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	report := &Report{curveID: tedwards.BN254, hashID: cfg.hashID, idBits: cfg.idBits}
+	digits := 1
+	if cfg.idBits > 0 {
+		digits = cfg.idBits
+	}
+	report.Coin0 = make([]frontend.Variable, digits)
+	report.Coin1 = make([]frontend.Variable, digits)
+	report.LDPVal = make([]frontend.Variable, digits)
+	report.K = make([]Point, digits)
+	report.Delta = make([]Point, digits)
+	report.RNDscalar = make([]frontend.Variable, digits)
+
+	if cfg.censusDepth > 0 {
+		report.CensusRegistry = []registry.HiddenCensus{registry.NewHiddenCensus(cfg.censusDepth)}
+	} else {
+		report.CensusPK = make([]eddsa.PublicKey, 1)
+	}
+
+	if cfg.registryDepth > 0 {
+		report.Registry = []Registry{{RegistryPath: merkle.NewCircuitPath(cfg.registryDepth)}}
+	} else {
+		report.Signature = []Signature{{ApkList: make([]frontend.Variable, numApks)}}
+	}
+
+	return report
+}
+
 // Define declares the circuit logic. The compiler then produces a list of constraints
 // which must be satisfied (valid witness) in order to create a valid zk-SNARK
-func (circuit *deltaCircuit) Define(api frontend.API) error {
+func (circuit *DeltaCircuit) Define(api frontend.API) error {
 
-	// Create the encryption circuit
-	curve, err := twistededwards.NewEdCurve(api, circuit.curveID)
+	// Check that cmXi = Commit(xi, r_xi)
+	err := hashfunctions.AssertCommitment(api, circuit.Report.hashID, circuit.CMXi, circuit.RXi, circuit.Xi)
 	if err != nil {
 		return err
 	}
 
-	hfunc, err := mimc.NewMiMC(api)
+	// Nu only binds the proof to the transaction: a public input which is not part
+	// of any constraint would not be checked by the verifier
+	api.Mul(circuit.Nu, circuit.Nu)
+
+	return circuit.Report.Define(api, circuit.Xi)
+}
+
+// Define declares the constraints of the report for the coins of xi, which must be
+// committed to by the caller.
+func (report *Report) Define(api frontend.API, xi frontend.Variable) error {
+
+	// Create the encryption circuit
+	curve, err := twistededwards.NewEdCurve(api, report.curveID)
 	if err != nil {
 		return err
 	}
-	hfunc.Write(circuit.Xi)
-	result := hfunc.Sum()
 
-	api.AssertIsEqual(result, circuit.CMXi)
+	digits := []frontend.Variable{report.ID}
+	if report.idBits > 0 {
+		if report.idBits > MaxIDBits {
+			return ErrIDBits
+		}
+		digits = api.ToBinary(report.ID, report.idBits)
+	}
 
-	ldpval, _ := LDP(api, circuit.Coin0, circuit.Coin1, circuit.Xi, circuit.ID)
+	censusPK := report.CensusPK
+	for i := range report.CensusRegistry {
+		census := &report.CensusRegistry[i]
+		if err = census.AssertRegistered(api, report.hashID, xi); err != nil {
+			return err
+		}
+		censusPK = []eddsa.PublicKey{census.EncKey}
+	}
 
-	api.AssertIsEqual(ldpval, circuit.LDPVal)
+	coins := bits.ToBinary(api, xi)
+	for i := range digits {
+		api.AssertIsEqual(coins[2*i], report.Coin0[i])
+		api.AssertIsEqual(coins[2*i+1], report.Coin1[i])
 
-	err = Encrypt(curve, circuit.RNDscalar, circuit.CensusPK, ldpval, circuit.Delta)
-	if err != nil {
-		return err
+		ldpval := randomResponse(api, coins[2*i], coins[2*i+1], digits[i])
+		api.AssertIsEqual(ldpval, report.LDPVal[i])
+
+		err = Encrypt(curve, report.RNDscalar[i], censusPK[0], ldpval, report.K[i], report.Delta[i])
+		if err != nil {
+			return err
+		}
 	}
 
-	hfunc.Reset()
-	hfunc.Write(circuit.ApkList[:]...)
-	hfunc.Write(circuit.ID)
-	signdata := hfunc.Sum()
+	for i := range report.Signature {
+		err = report.Signature[i].define(api, curve, report.hashID, report.ID)
+		if err != nil {
+			return err
+		}
+	}
+	for i := range report.Registry {
+		reg := &report.Registry[i]
+		err = registry.AssertRegistered(api, report.hashID, reg.RegistryRoot, reg.Apk, report.ID, &reg.RegistryPath)
+		if err != nil {
+			return err
+		}
+	}
 
-	// Verify sign_R
-	mimcSign, err := mimc.NewMiMC(api)
+	return nil
+}
+
+// AssertAddress checks, if enabled is 1, that apk is registered to the ID of the
+// report: that it is in the signed ApkList, or that it is the address proven to be
+// in the registry.
+func (report *Report) AssertAddress(api frontend.API, apk, enabled frontend.Variable) {
+	for i := range report.Signature {
+		prod := enabled
+		for _, a := range report.Signature[i].ApkList {
+			prod = api.Mul(prod, api.Sub(apk, a))
+		}
+		api.AssertIsEqual(prod, 0)
+	}
+	for i := range report.Registry {
+		api.AssertIsEqual(api.Mul(enabled, api.Sub(apk, report.Registry[i].Apk)), 0)
+	}
+}
+
+// define checks the signature of the registration authority over ApkList||id.
+func (sig *Signature) define(api frontend.API, curve twistededwards.Curve, h hashfunctions.HashID, id frontend.Variable) error {
+
+	hfunc, err := h.NewGadget(api)
 	if err != nil {
 		return err
 	}
-	err = eddsa.Verify(curve, circuit.RegAuthoritySignature, signdata, circuit.RegAuthorityPK, &mimcSign)
+	hfunc.Write(sig.ApkList[:]...)
+	hfunc.Write(id)
+	signdata := hfunc.Sum()
+
+	// Verify sign_R
+	mimcSign, err := h.NewGadget(api)
 	if err != nil {
 		return err
 	}
-
-	return nil
+	return eddsa.Verify(curve, sig.RegAuthoritySignature, signdata, sig.RegAuthorityPK, mimcSign)
 }
 
 func LDP(api frontend.API, coin0, coin1, xi, msg frontend.Variable) (frontend.Variable, error) {
@@ -92,18 +291,22 @@ func LDP(api frontend.API, coin0, coin1, xi, msg frontend.Variable) (frontend.Va
 	api.AssertIsEqual(coins[0], coin0)
 	api.AssertIsEqual(coins[1], coin1)
 
-	// Create the LDP circuit
-	c0 := api.IsZero(coins[0]) // Check first coin toss
-	c1 := api.IsZero(coins[1]) // Check second coin toss
+	return randomResponse(api, coins[0], coins[1], msg), nil
+}
 
-	ldp := api.Select(c0, msg, c1) // Calculate Random Response result
+// randomResponse is msg if coin0 is 0, else 1 if coin1 is 0 and 0 otherwise.
+func randomResponse(api frontend.API, coin0, coin1, msg frontend.Variable) frontend.Variable {
 
-	return ldp, nil
+	// Create the LDP circuit
+	c0 := api.IsZero(coin0) // Check first coin toss
+	c1 := api.IsZero(coin1) // Check second coin toss
 
+	return api.Select(c0, msg, c1) // Calculate Random Response result
 }
 
-// Encrypt creates the circuit matching the elgamal encryption
-func Encrypt(curve twistededwards.Curve, r frontend.Variable, pubkey eddsa.PublicKey, msg frontend.Variable, delta Point) error {
+// Encrypt creates the circuit matching the elgamal encryption: (k, delta) is the
+// ciphertext of msg under pubkey with randomness r.
+func Encrypt(curve twistededwards.Curve, r frontend.Variable, pubkey eddsa.PublicKey, msg frontend.Variable, k, delta Point) error {
 
 	base := twistededwards.Point{
 		X: curve.Params().Base[0],
@@ -115,7 +318,10 @@ func Encrypt(curve twistededwards.Curve, r frontend.Variable, pubkey eddsa.Publi
 	curve.AssertIsOnCurve(M)
 
 	// ElGamal-encrypt the point to produce ciphertext (K,C).
-	//K := curve.ScalarMul(base, r) // K = r * Base - Public key
+	K := curve.ScalarMul(base, r) // K = r * Base
+
+	curve.API().AssertIsEqual(K.X, k.X)
+	curve.API().AssertIsEqual(K.Y, k.Y)
 
 	S := curve.ScalarMul(pubkey.A, r) // S = r*A
 	curve.AssertIsOnCurve(S)
@@ -2,8 +2,14 @@ package deltacircuit
 
 import (
 	"blockchain_DP/elgamal"
+	"blockchain_DP/hashfunctions"
 	"blockchain_DP/ldp"
+	"blockchain_DP/merkle"
+	"blockchain_DP/note"
+	"blockchain_DP/prover"
+	"blockchain_DP/registry"
 	"crypto/rand"
+	"encoding/json"
 	"fmt"
 	"math/big"
 	"testing"
@@ -13,39 +19,10 @@ import (
 	fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
 	tedwardsbn254 "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards"
 	"github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
-	tedwards "github.com/consensys/gnark-crypto/ecc/twistededwards"
-	"github.com/consensys/gnark-crypto/hash"
-	"github.com/consensys/gnark-crypto/signature"
-	"github.com/consensys/gnark/backend/groth16"
-	"github.com/consensys/gnark/frontend"
-	"github.com/consensys/gnark/frontend/cs/r1cs"
-	"github.com/consensys/gnark/std/algebra/twistededwards"
+	"github.com/consensys/gnark/backend"
 	"github.com/consensys/gnark/test"
 )
 
-type InputOutput struct {
-	// Random value agreed upon with the census
-	Coin0 int
-	Coin1 int
-	Xi    fr.Element
-	CMXi  []byte
-
-	// private value hidden by LDP
-	ID     *big.Int
-	LDPVal big.Int
-	Delta  tedwardsbn254.PointAffine
-
-	curveID tedwards.ID
-
-	// Variables used for the elgamal encryption
-	RNDscalar *big.Int
-	CensusPK  elgamal.PublicKey
-
-	ApkList               []fr.Element
-	RegAuthorityPK        signature.PublicKey
-	RegAuthoritySignature []byte
-}
-
 func TestDeltaCircuit(t *testing.T) {
 	for _, numInputs := range []int{
 		1, 2, 4, 8, 16,
@@ -57,7 +34,7 @@ func TestDeltaCircuit(t *testing.T) {
 		n := 100
 
 		for i := 0; i < n; i++ {
-			timeS, timeP, timeV := RunBenchmark(t, numInputs, i)
+			timeS, timeP, timeV := RunBenchmark(t, numInputs, i, hashfunctions.MiMC, backend.GROTH16)
 			sumS += timeS
 			sumP += timeP
 			sumV += timeV
@@ -69,83 +46,97 @@ func TestDeltaCircuit(t *testing.T) {
 	}
 }
 
-func RunBenchmark(t *testing.T, numInputs int, iteration int) (time.Duration, time.Duration, time.Duration) {
-
-	assert := test.NewAssert(t)
-
-	snarkCurve, err := twistededwards.GetSnarkCurve(tedwards.BN254)
-	assert.NoError(err)
-
-	vals := setUpInputOutput(t, numInputs)
-
-	var circuit deltaCircuit
-	circuit.curveID = tedwards.BN254
-	circuit.ApkList = make([]frontend.Variable, len(vals.ApkList))
+func TestDeltaCircuitHashFunctions(t *testing.T) {
+	for _, hashID := range []hashfunctions.HashID{
+		hashfunctions.MiMC, hashfunctions.Poseidon,
+	} {
+		for _, numInputs := range []int{
+			1, 4,
+		} {
+			_, timeP, _ := RunBenchmark(t, numInputs, 0, hashID, backend.GROTH16)
+			fmt.Println(hashID, numInputs, "Proof time:", timeP)
+		}
+	}
+}
 
-	// verification with the correct Message
-	var assignment deltaCircuit
-	assignment.Coin0 = vals.Coin0
-	assignment.Coin1 = vals.Coin1
+func TestDeltaCircuitBackends(t *testing.T) {
+	for _, backendID := range []backend.ID{
+		backend.GROTH16, backend.PLONK,
+	} {
+		for _, numInputs := range []int{
+			1, 2, 4, 8, 16,
+		} {
+			timeS, timeP, timeV := RunBenchmark(t, numInputs, 0, hashfunctions.MiMC, backendID)
+			fmt.Println(backendID, numInputs, "Setup time:", timeS)
+			fmt.Println(backendID, numInputs, "Proof time:", timeP)
+			fmt.Println(backendID, numInputs, "Verification time:", timeV)
+		}
+	}
+}
 
-	assignment.Xi = vals.Xi.Marshal()
-	assignment.ID = vals.ID
-	assignment.LDPVal = vals.LDPVal
+func TestDeltaCircuitCommitmentOpening(t *testing.T) {
 
-	assignment.Delta.X = vals.Delta.X
-	assignment.Delta.Y = vals.Delta.Y
+	assert := test.NewAssert(t)
 
-	assignment.CMXi = vals.CMXi
+	vals := setUpInputOutput(t, 2, hashfunctions.MiMC)
+	circuit, assignment := setUpCircuit(t, vals, hashfunctions.MiMC)
 
-	assignment.RNDscalar = vals.RNDscalar
+	err := test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16)
+	assert.NoError(err)
 
-	//public key bytes
-	_publicKey := vals.CensusPK.A.Bytes()
-	// assign public key values
-	assignment.CensusPK.Assign(snarkCurve, _publicKey[:32])
+	// a commitment to xi without its opening must not be accepted
+	var r fr.Element
+	_, err = r.SetRandom()
+	assert.NoError(err)
+	assignment.RXi = r
+	err = test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16)
+	assert.Error(err, "wrong opening of cm_xi")
+}
 
-	assignment.ApkList = make([]frontend.Variable, len(vals.ApkList))
-	for i := 0; i < len(vals.ApkList); i++ {
-		assignment.ApkList[i] = vals.ApkList[i]
-	}
+func RunBenchmark(t *testing.T, numInputs int, iteration int, hashID hashfunctions.HashID, backendID backend.ID) (time.Duration, time.Duration, time.Duration) {
 
-	assignment.RegAuthorityPK.Assign(snarkCurve, vals.RegAuthorityPK.Bytes())
-	assignment.RegAuthoritySignature.Assign(snarkCurve, vals.RegAuthoritySignature)
+	vals := setUpInputOutput(t, numInputs, hashID)
+	circuit, assignment := setUpCircuit(t, vals, hashID)
 
-	ccs, err := frontend.Compile(ecc.BN254, r1cs.NewBuilder, &circuit)
+	ccs, err := prover.Compile(circuit, prover.WithBackend(backendID))
 	if err != nil {
 		panic(err)
 	}
 
+	opts := []prover.Option{prover.WithBackend(backendID)}
+	if backendID == backend.PLONK {
+		srs, err := prover.NewUnsafeSRS(prover.SRSSize(ccs))
+		if err != nil {
+			panic(err)
+		}
+		opts = append(opts, prover.WithSRS(srs))
+	}
+
 	t1 := time.Now()
-	pk, vk, err := groth16.Setup(ccs)
+	keys, err := prover.Setup(ccs, opts...)
 	if err != nil {
 		panic(err)
 	}
 	tSetUP := time.Since(t1)
 
 	if iteration == 0 {
-		fmt.Println("Total", ccs.GetNbConstraints(), "constraints")
-	}
-
-	witness, err := frontend.NewWitness(&assignment, ecc.BN254)
-	if err != nil {
-		panic(err)
+		fmt.Println(backendID, hashID, "Total", ccs.GetNbConstraints(), "constraints")
 	}
 
-	publicWitness, err := witness.Public()
+	publicWitness, err := prover.PublicWitness(assignment)
 	if err != nil {
 		panic(err)
 	}
 
 	t1 = time.Now()
-	proof, err := groth16.Prove(ccs, pk, witness)
+	proof, err := prover.Prove(keys, assignment)
 	if err != nil {
 		panic(err)
 	}
 	tProof := time.Since(t1)
 
 	t1 = time.Now()
-	err = groth16.Verify(proof, vk, publicWitness)
+	err = prover.Verify(keys.VK, proof, publicWitness)
 	if err != nil {
 		panic(err)
 	}
@@ -154,83 +145,347 @@ func RunBenchmark(t *testing.T, numInputs int, iteration int) (time.Duration, ti
 	return tSetUP, tProof, tVerify
 }
 
-func setUpInputOutput(t *testing.T, numInputs int) InputOutput {
+func TestDeltaCircuitCiphertext(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	vals := setUpInputOutput(t, 2, hashfunctions.MiMC)
+
+	// re-encrypt under a census key we hold
+	privateKey, err := elgamal.GenerateKey(rand.Reader)
+	assert.NoError(err, "generating elgamal private key")
+	assert.NoError(vals.SetReport(privateKey.PublicKey, 0))
+
+	circuit, assignment := setUpCircuit(t, vals, hashfunctions.MiMC)
+	assert.NoError(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+
+	// the census decrypts from the public witness alone
+	publicWitness, err := prover.PublicWitness(assignment)
+	assert.NoError(err)
+	data, err := publicWitness.MarshalJSON()
+	assert.NoError(err)
+	var public publicReport
+	assert.NoError(json.Unmarshal(data, &public))
+
+	mm := public.decrypt(privateKey)
+	assert.Equal(vals.LDPVal, mm, "decrypting the public ciphertext")
+
+	// K must be RNDscalar*Base
+	other := vals
+	other.K = []tedwardsbn254.PointAffine{vals.K[0]}
+	other.K[0].Add(&other.K[0], &other.K[0])
+	_, assignment = setUpCircuit(t, other, hashfunctions.MiMC)
+	assert.Error(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+}
+
+// publicReport is the report in the JSON encoding of the public witness.
+type publicReport struct {
+	Report struct {
+		K, Delta []struct{ X, Y fr.Element }
+	}
+}
+
+// decrypt decrypts each digit of the report.
+func (public *publicReport) decrypt(privateKey *elgamal.PrivateKey) []big.Int {
+	res := make([]big.Int, len(public.Report.K))
+	for i := range res {
+		var K, delta tedwardsbn254.PointAffine
+		K.X, K.Y = public.Report.K[i].X, public.Report.K[i].Y
+		delta.X, delta.Y = public.Report.Delta[i].X, public.Report.Delta[i].Y
+		res[i] = elgamal.Decrypt(*privateKey, K, delta)
+	}
+	return res
+}
 
+func TestDeltaCircuitIDBits(t *testing.T) {
 	assert := test.NewAssert(t)
 
-	var vals InputOutput
-	params, err := twistededwards.GetCurveParams(tedwards.BN254)
+	const idBits = 16
+	vals := setUpInputOutput(t, 2, hashfunctions.MiMC)
+	vals.ID = big.NewInt(0xbeef)
+	signRegistration(t, &vals, hashfunctions.MiMC)
+
+	privateKey, err := elgamal.GenerateKey(rand.Reader)
+	assert.NoError(err, "generating elgamal private key")
+	assert.NoError(vals.SetReport(privateKey.PublicKey, idBits))
+
+	circuit := NewDeltaCircuit(2, WithHash(hashfunctions.MiMC), WithIDBits(idBits))
+	assignment, err := vals.Assign()
 	assert.NoError(err)
+	assert.NoError(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
 
-	_, err = vals.Xi.SetRandom()
-	assert.NoError(err, "Setting random value (xi_C)")
+	// the census decrypts each bit, where the coins let the bit of the ID through
+	publicWitness, err := prover.PublicWitness(assignment)
+	assert.NoError(err)
+	data, err := publicWitness.MarshalJSON()
+	assert.NoError(err)
+	var public publicReport
+	assert.NoError(json.Unmarshal(data, &public))
+
+	bits := public.decrypt(privateKey)
+	assert.Equal(idBits, len(bits))
+	for i := range bits {
+		assert.Equal(vals.LDPVal[i], bits[i], "decrypting bit %d", i)
+		if vals.Coin0[i] == 0 {
+			assert.Equal(int64(vals.ID.Bit(i)), bits[i].Int64(), "bit %d", i)
+		}
+	}
 
-	// running MiMC (Go)
-	goMimc := hash.MIMC_BN254.New()
-	goMimc.Write(vals.Xi.Marshal())
-	vals.CMXi = goMimc.Sum(nil)
+	// IDs which do not fit in idBits bits are rejected
+	assert.Error(vals.SetReport(privateKey.PublicKey, 8))
+	assert.ErrorIs(vals.SetReport(privateKey.PublicKey, MaxIDBits+1), ErrIDBits)
 
-	vals.ID = big.NewInt(int64(1))
-	vals.LDPVal, vals.Coin0, vals.Coin1 = ldp.RandomResponse(vals.Xi, vals.ID)
+	// even with a report of their low bits
+	other := vals
+	other.ID = new(big.Int).Add(vals.ID, big.NewInt(1<<idBits))
+	signRegistration(t, &other, hashfunctions.MiMC)
+	assignment, err = other.Assign()
+	assert.NoError(err)
+	assert.Error(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+}
 
-	// Calculate encrypt(delta)
+func TestDeltaCircuitRegistry(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	const depth = 8
+	vals := setUpInputOutput(t, 1, hashfunctions.MiMC)
+
+	// the registration authority registers the addresses of several IDs
+	reg, err := registry.New(hashfunctions.MiMC, depth)
+	assert.NoError(err)
+	apks := make([]fr.Element, 3)
+	for i := range apks {
+		_, err = apks[i].SetRandom()
+		assert.NoError(err)
+		assert.NoError(reg.Register(apks[i], big.NewInt(int64(i+1))))
+	}
+
+	vals.Apk = apks[0]
+	vals.RegistryPath, err = reg.Path(vals.Apk)
+	assert.NoError(err)
+	vals.RegistryRoot = reg.Root()
+
+	circuit := NewDeltaCircuit(0, WithHash(hashfunctions.MiMC), WithRegistry(depth))
+	assignment, err := vals.Assign()
+	assert.NoError(err)
+	assert.NoError(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+
+	// the signature is not part of the circuit
+	_, err = prover.Compile(circuit)
+	assert.NoError(err)
+
+	// an address registered to another ID
+	other := vals
+	other.Apk = apks[1]
+	other.RegistryPath, err = reg.Path(other.Apk)
+	assert.NoError(err)
+	assignment, err = other.Assign()
+	assert.NoError(err)
+	assert.Error(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+}
+
+func TestDeltaCircuitCensusRegistry(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	const depth = 8
+	vals := setUpInputOutput(t, 1, hashfunctions.MiMC)
+
+	// the registry of three census authorities, each by its signing and encryption keys
+	tree, err := merkle.New(hashfunctions.MiMC, depth)
+	assert.NoError(err)
+	keys := make([]*elgamal.PrivateKey, 3)
+	sigKeys := make([]*eddsa.PrivateKey, 3)
+	leaves := make([]fr.Element, 3)
+	for i := range keys {
+		keys[i], err = elgamal.GenerateKey(rand.Reader)
+		assert.NoError(err)
+		sigKeys[i], err = eddsa.GenerateKey(rand.Reader)
+		assert.NoError(err)
+		leaves[i] = registry.CensusLeaf(hashfunctions.MiMC, sigKeys[i].PublicKey.A, keys[i].PublicKey.A)
+		_, err = tree.Append(leaves[i])
+		assert.NoError(err)
+	}
+
+	assert.NoError(vals.SetReport(keys[1].PublicKey, 0))
+	vals.CensusPath, err = tree.Path(1)
+	assert.NoError(err)
+	vals.CensusRoot = tree.Root()
+	vals.CensusSigPK = sigKeys[1].Public()
+	vals.CensusBinding = registry.CensusBinding(hashfunctions.MiMC, leaves[1], vals.Xi)
+
+	circuit := NewDeltaCircuit(1, WithHash(hashfunctions.MiMC), WithCensusRegistry(depth))
+	assignment, err := vals.Assign()
+	assert.NoError(err)
+	assert.NoError(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+
+	// the public witness holds the root of the registry instead of the census key
+	publicWitness, err := prover.PublicWitness(assignment)
+	assert.NoError(err)
+	data, err := publicWitness.MarshalJSON()
+	assert.NoError(err)
+	var census struct {
+		Report struct {
+			CensusPK       []struct{}
+			CensusRegistry []struct{ Root fr.Element }
+		}
+	}
+	assert.NoError(json.Unmarshal(data, &census))
+	assert.Equal(0, len(census.Report.CensusPK))
+	assert.Equal(1, len(census.Report.CensusRegistry))
+	assert.True(census.Report.CensusRegistry[0].Root.Equal(&vals.CensusRoot))
+
+	// the census re-randomizes the ciphertext before decrypting it
+	curve := tedwardsbn254.GetEdwardsCurve()
+	var public publicReport
+	assert.NoError(json.Unmarshal(data, &public))
+	var ciphK, ciphDelta tedwardsbn254.PointAffine
+	ciphK.X, ciphK.Y = public.Report.K[0].X, public.Report.K[0].Y
+	ciphDelta.X, ciphDelta.Y = public.Report.Delta[0].X, public.Report.Delta[0].Y
+	ciphK, ciphDelta = elgamal.Rerandomize(keys[1].PublicKey, elgamal.GenScalar(&curve.Order), ciphK, ciphDelta)
+	assert.False(ciphK.Equal(&vals.K[0]))
+	mm := elgamal.Decrypt(*keys[1], ciphK, ciphDelta)
+	assert.Equal(0, mm.Cmp(&vals.LDPVal[0]), "decrypting the re-randomized ciphertext")
+
+	// a key which is not in the registry
+	unknown, err := elgamal.GenerateKey(rand.Reader)
+	assert.NoError(err)
+	other := vals
+	assert.NoError(other.SetReport(unknown.PublicKey, 0))
+	assignment, err = other.Assign()
+	assert.NoError(err)
+	assert.Error(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+
+	// nor the path of another key
+	assert.NoError(other.SetReport(keys[1].PublicKey, 0))
+	other.CensusPath, err = tree.Path(0)
+	assert.NoError(err)
+	assignment, err = other.Assign()
+	assert.NoError(err)
+	assert.Error(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+
+	// nor the encryption key of a census with the signing key of another one
+	other.CensusPath, err = tree.Path(1)
+	assert.NoError(err)
+	other.CensusSigPK = sigKeys[0].Public()
+	other.CensusBinding = registry.CensusBinding(hashfunctions.MiMC,
+		registry.CensusLeaf(hashfunctions.MiMC, sigKeys[0].PublicKey.A, keys[1].PublicKey.A), vals.Xi)
+	assignment, err = other.Assign()
+	assert.NoError(err)
+	assert.Error(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+}
+
+func TestDeltaWitnessInput(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	const depth, idBits = 8, 8
 	elgamal.MessageMapInit()
+	in := DeltaWitnessInput{ID: big.NewInt(42), IDBits: idBits, Nu: []byte{1}}
+	for _, e := range []*fr.Element{&in.Xi, &in.RXi, &in.Apk} {
+		_, err := e.SetRandom()
+		assert.NoError(err)
+	}
+	privateKey, err := elgamal.GenerateKey(rand.Reader)
+	assert.NoError(err)
+	in.CensusPK = privateKey.PublicKey
 
-	// Create a public/private keypair
-	privateKey, err := elgamal.GenerateKey(rand.Reader) // Alice's private key
-	assert.NoError(err, "generating elgamal private key")
-	vals.CensusPK = privateKey.PublicKey // Alice's public key
+	// the address is registered in the registry rather than signed
+	in.Registry, err = registry.New(hashfunctions.MiMC, depth)
+	assert.NoError(err)
+	assert.NoError(in.Registry.Register(in.Apk, in.ID))
 
-	vals.RNDscalar = elgamal.GenScalar(params.Order) // bob's random scalar
+	circuit := NewDeltaCircuit(0, WithHash(hashfunctions.MiMC), WithRegistry(depth), WithIDBits(idBits))
+	assignment, public, err := in.Assign(hashfunctions.MiMC)
+	assert.NoError(err)
+	assert.NoError(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
 
-	// ElGamal-encrypt a message using the public key.
-	//var K tedwardsbn254.PointAffine
-	K, delta := elgamal.Encrypt(vals.CensusPK, vals.RNDscalar, &vals.LDPVal)
-	vals.Delta.X = delta.X
-	vals.Delta.Y = delta.Y
+	// the census decrypts the LDP of each bit from the public witness
+	data, err := public.MarshalJSON()
+	assert.NoError(err)
+	var report publicReport
+	assert.NoError(json.Unmarshal(data, &report))
+	res, _, _ := ldp.RandomResponseBits(in.Xi, in.ID, idBits)
+	assert.Equal(res, report.decrypt(privateKey))
 
-	// Decrypt it using the corresponding private key.
-	mm := elgamal.Decrypt(*privateKey, K, vals.Delta)
-	assert.Equal(mm, vals.LDPVal, "Decryption succeeded")
+	// an address which is not registered
+	_, err = in.Apk.SetRandom()
+	assert.NoError(err)
+	_, _, err = in.Assign(hashfunctions.MiMC)
+	assert.ErrorIs(err, registry.ErrNotRegistered)
+}
+
+func setUpCircuit(t *testing.T, vals Witness, hashID hashfunctions.HashID) (circuit, assignment *DeltaCircuit) {
+
+	assert := test.NewAssert(t)
+
+	circuit = NewDeltaCircuit(len(vals.ApkList), WithHash(hashID))
+
+	// verification with the correct Message
+	assignment, err := vals.Assign()
+	assert.NoError(err)
+
+	return circuit, assignment
+}
+
+func setUpInputOutput(t *testing.T, numInputs int, hashID hashfunctions.HashID) Witness {
+
+	assert := test.NewAssert(t)
+
+	var in DeltaWitnessInput
+	var nu fr.Element
+	for _, e := range []*fr.Element{&in.Xi, &in.RXi, &nu} {
+		_, err := e.SetRandom()
+		assert.NoError(err)
+	}
+	in.Nu = nu.Marshal()
+	in.ID = big.NewInt(int64(1))
 
-	vals.ApkList = make([]fr.Element, numInputs)
+	// the LDP of the ID is encrypted under the census key
+	elgamal.MessageMapInit()
+	privateKey, err := elgamal.GenerateKey(rand.Reader)
+	assert.NoError(err, "generating elgamal private key")
+	in.CensusPK = privateKey.PublicKey
 
-	hfunc := hash.MIMC_BN254.New()
+	// the registration authority signs a_pk_1||...||a_pk_n||ID
+	in.ApkList = make([]fr.Element, numInputs)
 	for i := 0; i < numInputs; i++ {
-		// Compute a_sk
-		var aSK, zero, apkElement fr.Element
+		var aSK fr.Element
 		_, err = aSK.SetRandom()
-		assert.NoError(err, "Setting random value (xi_C)")
-
-		// Compute a_pk
-		zero.SetZero()
-		hfunc.Reset()
-		hfunc.Write(aSK.Marshal())
-		hfunc.Write(zero.Marshal())
-		apk := hfunc.Sum(nil)
-		vals.ApkList[i].Set(apkElement.SetBytes(apk))
+		assert.NoError(err, "Setting random value (a_sk)")
+		in.ApkList[i] = note.Address(hashID, aSK)
 	}
+	regKey, err := eddsa.GenerateKey(rand.Reader)
+	assert.NoError(err, "generating eddsa key pair")
+	in.RegAuthoritySignature, err = regKey.Sign(RegistrationData(hashID, in.ApkList, in.ID), hashID.New())
+	assert.NoError(err, "signing message")
+	in.RegAuthorityPK = regKey.Public()
+
+	vals, err := in.Build(hashID)
+	assert.NoError(err)
+
+	// Decrypt it using the corresponding private key.
+	mm := elgamal.Decrypt(*privateKey, vals.K[0], vals.Delta[0])
+	assert.Equal(mm, vals.LDPVal[0], "Decryption succeeded")
+
+	return *vals
+}
+
+// signRegistration signs ApkList||ID as the registration authority.
+func signRegistration(t *testing.T, vals *Witness, hashID hashfunctions.HashID) {
+
+	assert := test.NewAssert(t)
 
 	// Sign and Verify "a_pk||id"
 	privKey, err := eddsa.GenerateKey(rand.Reader)
 	assert.NoError(err, "generating eddsa key pair")
 
-	hfunc.Reset()
-	for i := 0; i < numInputs; i++ {
-		hfunc.Write(vals.ApkList[i].Marshal())
-	}
-	hfunc.Write(vals.ID.Bytes())
-	signData := hfunc.Sum(nil)
+	signData := RegistrationData(hashID, vals.ApkList, vals.ID)
 
 	// generate signature
-	vals.RegAuthoritySignature, err = privKey.Sign(signData[:], hash.MIMC_BN254.New())
+	vals.RegAuthoritySignature, err = privKey.Sign(signData[:], hashID.New())
 	assert.NoError(err, "signing message")
 
 	// check if there is no problem with the signature
 	vals.RegAuthorityPK = privKey.Public()
-	checkSig, err := vals.RegAuthorityPK.Verify(vals.RegAuthoritySignature, signData[:], hash.MIMC_BN254.New())
+	checkSig, err := vals.RegAuthorityPK.Verify(vals.RegAuthoritySignature, signData[:], hashID.New())
 	assert.NoError(err, "verifying signature")
 	assert.True(checkSig, "signature verification failed")
-
-	return vals
 }
@@ -0,0 +1,181 @@
+package deltacircuit
+
+import (
+	"blockchain_DP/elgamal"
+	"blockchain_DP/ldp"
+	"blockchain_DP/merkle"
+	"blockchain_DP/registry"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	tedwardsbn254 "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards"
+	eddsabn254 "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+	"github.com/consensys/gnark-crypto/signature"
+	"github.com/consensys/gnark/frontend"
+	eddsa "github.com/consensys/gnark/std/signature/eddsa"
+)
+
+// Witness holds the native values of an assignment of the delta circuit.
+type Witness struct {
+	// Random value agreed upon with the census, for each digit of the ID
+	Coin0 []int
+	Coin1 []int
+	Xi    fr.Element
+	RXi   fr.Element
+	CMXi  []byte
+
+	// nu_2 of the xi proof of the same transaction
+	Nu []byte
+
+	// private value hidden by LDP, and its ciphertexts, for each digit of the ID
+	ID     *big.Int
+	LDPVal []big.Int
+	K      []tedwardsbn254.PointAffine
+	Delta  []tedwardsbn254.PointAffine
+
+	// Variables used for the elgamal encryption
+	RNDscalar []*big.Int
+	CensusPK  elgamal.PublicKey
+
+	// The census hidden in the registry of census keys, instead of its key being public,
+	// if CensusPath is set: its signing key and the CensusBinding of its leaf with xi
+	CensusPath    merkle.Path
+	CensusRoot    fr.Element
+	CensusSigPK   signature.PublicKey
+	CensusBinding fr.Element
+
+	// Registration by a signature of the registration authority
+	ApkList               []fr.Element
+	RegAuthorityPK        signature.PublicKey
+	RegAuthoritySignature []byte
+
+	// Registration in the registry, used instead of the signature if RegistryPath is set
+	Apk          fr.Element
+	RegistryPath merkle.Path
+	RegistryRoot fr.Element
+}
+
+// Assign returns the circuit assignment of the witness.
+func (w *Witness) Assign() (*DeltaCircuit, error) {
+	if w.Nu == nil {
+		return nil, fmt.Errorf("assigning delta witness: missing nu")
+	}
+
+	report, err := w.AssignReport()
+	if err != nil {
+		return nil, err
+	}
+
+	assignment := &DeltaCircuit{Report: *report}
+	assignment.Xi = w.Xi
+	assignment.RXi = w.RXi
+	assignment.CMXi = w.CMXi
+	assignment.Nu = w.Nu
+
+	return assignment, nil
+}
+
+// AssignReport returns the assignment of the report of the witness, leaving out xi,
+// its commitment and nu.
+func (w *Witness) AssignReport() (assignment *Report, err error) {
+	// eddsa assignments panic on malformed keys and signatures
+	defer func() {
+		if r := recover(); r != nil {
+			assignment, err = nil, fmt.Errorf("assigning delta witness: %v", r)
+		}
+	}()
+
+	if w.ID == nil || len(w.RNDscalar) == 0 {
+		return nil, fmt.Errorf("assigning delta witness: missing ID or encryption randomness")
+	}
+	digits := len(w.RNDscalar)
+	if len(w.Coin0) != digits || len(w.Coin1) != digits || len(w.LDPVal) != digits || len(w.K) != digits || len(w.Delta) != digits {
+		return nil, fmt.Errorf("assigning delta witness: %d digits expected", digits)
+	}
+
+	assignment = &Report{}
+	assignment.ID = w.ID
+	assignment.Coin0 = make([]frontend.Variable, digits)
+	assignment.Coin1 = make([]frontend.Variable, digits)
+	assignment.LDPVal = make([]frontend.Variable, digits)
+	assignment.K = make([]Point, digits)
+	assignment.Delta = make([]Point, digits)
+	assignment.RNDscalar = make([]frontend.Variable, digits)
+	for i := 0; i < digits; i++ {
+		assignment.Coin0[i] = w.Coin0[i]
+		assignment.Coin1[i] = w.Coin1[i]
+		assignment.LDPVal[i] = w.LDPVal[i]
+		assignment.K[i] = Point{X: w.K[i].X, Y: w.K[i].Y}
+		assignment.Delta[i] = Point{X: w.Delta[i].X, Y: w.Delta[i].Y}
+		assignment.RNDscalar[i] = w.RNDscalar[i]
+	}
+
+	if w.CensusPath.Siblings != nil {
+		var sigPK eddsabn254.PublicKey
+		if _, err = sigPK.SetBytes(w.CensusSigPK.Bytes()); err != nil {
+			return nil, fmt.Errorf("assigning delta witness: %w", err)
+		}
+		assignment.CensusRegistry = []registry.HiddenCensus{
+			registry.AssignHiddenCensus(sigPK.A, w.CensusPK.A, w.CensusPath, w.CensusRoot, w.CensusBinding),
+		}
+	} else {
+		censusPK := w.CensusPK.A.Bytes()
+		assignment.CensusPK = make([]eddsa.PublicKey, 1)
+		assignment.CensusPK[0].Assign(ecc.BN254, censusPK[:])
+	}
+
+	if w.RegistryPath.Siblings != nil {
+		assignment.Registry = []Registry{{
+			Apk:          w.Apk,
+			RegistryPath: w.RegistryPath.Assign(),
+			RegistryRoot: w.RegistryRoot,
+		}}
+		return assignment, nil
+	}
+
+	var sig Signature
+	sig.ApkList = make([]frontend.Variable, len(w.ApkList))
+	for i := 0; i < len(w.ApkList); i++ {
+		sig.ApkList[i] = w.ApkList[i]
+	}
+	sig.RegAuthorityPK.Assign(ecc.BN254, w.RegAuthorityPK.Bytes())
+	sig.RegAuthoritySignature.Assign(ecc.BN254, w.RegAuthoritySignature)
+	assignment.Signature = []Signature{sig}
+
+	return assignment, nil
+}
+
+// SetReport computes the LDP of the ID with the coins of Xi, digit by digit: the whole
+// ID if idBits is 0, else each of its idBits bits. Each digit is encrypted under pk
+// with fresh randomness.
+func (w *Witness) SetReport(pk elgamal.PublicKey, idBits int) error {
+	if w.ID == nil {
+		return fmt.Errorf("reporting delta witness: missing ID")
+	}
+
+	if idBits == 0 {
+		res, c0, c1 := ldp.RandomResponse(w.Xi, w.ID)
+		w.LDPVal, w.Coin0, w.Coin1 = []big.Int{res}, []int{c0}, []int{c1}
+	} else {
+		if idBits > MaxIDBits {
+			return ErrIDBits
+		}
+		if w.ID.Sign() < 0 || w.ID.BitLen() > idBits {
+			return fmt.Errorf("reporting delta witness: ID does not fit in %d bits", idBits)
+		}
+		w.LDPVal, w.Coin0, w.Coin1 = ldp.RandomResponseBits(w.Xi, w.ID, idBits)
+	}
+
+	curve := tedwardsbn254.GetEdwardsCurve()
+	w.CensusPK = pk
+	w.RNDscalar = make([]*big.Int, len(w.LDPVal))
+	w.K = make([]tedwardsbn254.PointAffine, len(w.LDPVal))
+	w.Delta = make([]tedwardsbn254.PointAffine, len(w.LDPVal))
+	for i := range w.LDPVal {
+		w.RNDscalar[i] = elgamal.GenScalar(&curve.Order)
+		w.K[i], w.Delta[i] = elgamal.Encrypt(pk, w.RNDscalar[i], &w.LDPVal[i])
+	}
+	return nil
+}
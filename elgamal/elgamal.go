@@ -104,6 +104,22 @@ func Encrypt(pubkey PublicKey, r *big.Int, msg *big.Int) (K, Ciph twistededwards
 	return
 }
 
+// Rerandomize returns (K + r*Base, C + r*A), a fresh encryption under pubkey of the message
+// of (K, C). The census re-randomizes the ciphertexts it collects before decrypting or
+// forwarding them, so that they can not be linked back to the transactions reporting them.
+func Rerandomize(pubkey PublicKey, r *big.Int, K, C twistededwards.PointAffine) (K2, C2 twistededwards.PointAffine) {
+
+	curve := twistededwards.GetEdwardsCurve()
+
+	var R, S twistededwards.PointAffine
+	R.ScalarMul(&curve.Base, r)
+	S.ScalarMul(&pubkey.A, r)
+	K2.Add(&K, &R)
+	C2.Add(&C, &S)
+
+	return
+}
+
 // Decrypt decrypts cipher C using Alice's private key prive, and Bob's value K
 func Decrypt(priv PrivateKey, K, C twistededwards.PointAffine) (msg big.Int) {
 
@@ -41,3 +41,24 @@ func Example() {
 	// Output:
 	// Decryption succeeded: 45
 }
+
+func ExampleRerandomize() {
+
+	MessageMapInit()
+
+	privateKey, _ := GenerateKey(rand.Reader)
+	publicKey := privateKey.PublicKey
+
+	c := twistededwards.GetEdwardsCurve()
+	K, C := Encrypt(publicKey, GenScalar(&c.Order), big.NewInt(int64(7)))
+
+	// The re-randomized ciphertext differs but decrypts to the same message
+	K2, C2 := Rerandomize(publicKey, GenScalar(&c.Order), K, C)
+	mm := Decrypt(*privateKey, K2, C2)
+	fmt.Println("Same ciphertext:", K2.Equal(&K) || C2.Equal(&C))
+	fmt.Println("Decryption succeeded:", mm.Int64())
+
+	// Output:
+	// Same ciphertext: false
+	// Decryption succeeded: 7
+}
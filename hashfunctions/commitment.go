@@ -0,0 +1,63 @@
+package hashfunctions
+
+import (
+	"bytes"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/frontend"
+)
+
+// Commit computes the hiding commitment cm = H(data||r).
+// r is the opening and must be sampled uniformly at random for every commitment.
+func Commit(r fr.Element, data ...fr.Element) (cm []byte) {
+	return MiMC.Commit(r, data...)
+}
+
+// Open checks that cm is a commitment to data with opening r.
+func Open(cm []byte, r fr.Element, data ...fr.Element) bool {
+	return MiMC.Open(cm, r, data...)
+}
+
+// Commit is the package level Commit computed with the hash function h.
+func (h HashID) Commit(r fr.Element, data ...fr.Element) (cm []byte) {
+
+	hfunc := h.New()
+	for i := 0; i < len(data); i++ {
+		hfunc.Write(data[i].Marshal())
+	}
+	hfunc.Write(r.Marshal())
+	cm = hfunc.Sum(nil)
+
+	return cm
+}
+
+// Open is the package level Open computed with the hash function h.
+func (h HashID) Open(cm []byte, r fr.Element, data ...fr.Element) bool {
+	return bytes.Equal(h.Commit(r, data...), cm)
+}
+
+// CommitGadget is the gadget computing cm = H(data||r).
+func CommitGadget(api frontend.API, h HashID, r frontend.Variable, data ...frontend.Variable) (frontend.Variable, error) {
+
+	hfunc, err := h.NewGadget(api)
+	if err != nil {
+		return nil, err
+	}
+	hfunc.Write(data...)
+	hfunc.Write(r)
+
+	return hfunc.Sum(), nil
+}
+
+// AssertCommitment is the gadget checking that cm = H(data||r).
+func AssertCommitment(api frontend.API, h HashID, cm, r frontend.Variable, data ...frontend.Variable) error {
+
+	result, err := CommitGadget(api, h, r, data...)
+	if err != nil {
+		return err
+	}
+
+	api.AssertIsEqual(result, cm)
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package hashfunctions
+
+import (
+	"errors"
+	"hash"
+
+	gchash "github.com/consensys/gnark-crypto/hash"
+	"github.com/consensys/gnark/frontend"
+	gnarkhash "github.com/consensys/gnark/std/hash"
+	"github.com/consensys/gnark/std/hash/mimc"
+)
+
+// HashID selects the hash function used by the commitments, PRFs and signatures.
+// The zero value is MiMC, so circuits that do not set it keep their original shape.
+type HashID uint8
+
+const (
+	MiMC HashID = iota
+	Poseidon
+)
+
+var ErrUnknownHash = errors.New("unknown hash function")
+
+func (h HashID) String() string {
+	switch h {
+	case MiMC:
+		return "MiMC"
+	case Poseidon:
+		return "Poseidon"
+	default:
+		return "unknown"
+	}
+}
+
+// Check returns ErrUnknownHash if h is not a known hash function.
+func (h HashID) Check() error {
+	switch h {
+	case MiMC, Poseidon:
+		return nil
+	default:
+		return ErrUnknownHash
+	}
+}
+
+// New returns the native implementation of the hash function. It panics on an unknown
+// HashID: the constructors taking a HashID check it with Check instead.
+func (h HashID) New() hash.Hash {
+	switch h {
+	case MiMC:
+		return gchash.MIMC_BN254.New()
+	case Poseidon:
+		return NewPoseidon()
+	default:
+		panic(ErrUnknownHash)
+	}
+}
+
+// NewGadget returns the in-circuit implementation of the hash function.
+func (h HashID) NewGadget(api frontend.API) (gnarkhash.Hash, error) {
+	switch h {
+	case MiMC:
+		hfunc, err := mimc.NewMiMC(api)
+		if err != nil {
+			return nil, err
+		}
+		return &hfunc, nil
+	case Poseidon:
+		return newPoseidonGadget(api), nil
+	default:
+		return nil, ErrUnknownHash
+	}
+}
@@ -2,20 +2,24 @@ package hashfunctions
 
 import (
 	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
-	"github.com/consensys/gnark-crypto/hash"
 )
 
 // PFRZerocash computes the different PRF functions used by zerocash.
 // x is the seed (256 bits). z is the input (256 bits).
 // t is the type of the PRF we are using: 0 - PRF_addr, 1 - PRF_sn, 2 - PRF_pk
 func PFRSN(x fr.Element, z fr.Element) (res fr.Element) {
+	return MiMC.PRFSN(x, z)
+}
+
+// PRFSN is PFRSN computed with the hash function h.
+func (h HashID) PRFSN(x fr.Element, z fr.Element) (res fr.Element) {
 
 	var c fr.Element
 	c.SetBytes([]byte{0b0, 0b1})
 	//z.FromMont()
 
 	//fmt.Println(x.String(), "\n", c.String(), "\n", z.String())
-	hfunc := hash.MIMC_BN254.New()
+	hfunc := h.New()
 	hfunc.Write(x.Marshal())
 	hfunc.Write(c.Marshal())
 	hfunc.Write(z.Marshal())
@@ -26,13 +30,25 @@ func PFRSN(x fr.Element, z fr.Element) (res fr.Element) {
 }
 
 func PRFNu(omega []fr.Element, i fr.Element) (nu []byte) {
+	return MiMC.PRFNu(omega, i)
+}
 
-	hNu1 := hash.MIMC_BN254.New()
-	for i := 0; i < len(omega); i++ {
-		hNu1.Write(omega[i].Marshal())
+// PRFNu is the package level PRFNu computed with the hash function h: nu = H(acc||i),
+// where acc chains the omegas of the notes spent, acc_k = H(acc_{k-1}||omega_k) from
+// acc_0 = 0. A circuit with more slots than notes spent computes the same chain by
+// skipping its dummy slots.
+func (h HashID) PRFNu(omega []fr.Element, i fr.Element) (nu []byte) {
+	var acc fr.Element
+	hfunc := h.New()
+	for k := range omega {
+		hfunc.Reset()
+		hfunc.Write(acc.Marshal())
+		hfunc.Write(omega[k].Marshal())
+		acc.SetBytes(hfunc.Sum(nil))
 	}
-	hNu1.Write(i.Marshal())
-	nu = hNu1.Sum(nil)
 
-	return nu
+	hfunc.Reset()
+	hfunc.Write(acc.Marshal())
+	hfunc.Write(i.Marshal())
+	return hfunc.Sum(nil)
 }
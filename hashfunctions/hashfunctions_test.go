@@ -0,0 +1,132 @@
+package hashfunctions
+
+import (
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+)
+
+type hashCircuit struct {
+	hashID HashID
+	Data   []frontend.Variable
+	Digest frontend.Variable `gnark:",public"`
+}
+
+func (circuit *hashCircuit) Define(api frontend.API) error {
+	hfunc, err := circuit.hashID.NewGadget(api)
+	if err != nil {
+		return err
+	}
+	hfunc.Write(circuit.Data...)
+	api.AssertIsEqual(hfunc.Sum(), circuit.Digest)
+	return nil
+}
+
+func TestHashGadgets(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	for _, hashID := range []HashID{MiMC, Poseidon} {
+		for _, size := range []int{1, 2, 3, 5} {
+			data := make([]fr.Element, size)
+			hfunc := hashID.New()
+			for i := range data {
+				_, err := data[i].SetRandom()
+				assert.NoError(err)
+				hfunc.Write(data[i].Marshal())
+			}
+
+			var circuit, assignment hashCircuit
+			circuit.hashID = hashID
+			circuit.Data = make([]frontend.Variable, size)
+			assignment.Data = make([]frontend.Variable, size)
+			for i := range data {
+				assignment.Data[i] = data[i]
+			}
+			assignment.Digest = hfunc.Sum(nil)
+
+			err := test.IsSolved(&circuit, &assignment, ecc.BN254, backend.GROTH16)
+			assert.NoError(err, hashID.String())
+
+			assignment.Digest = data[0]
+			err = test.IsSolved(&circuit, &assignment, ecc.BN254, backend.GROTH16)
+			assert.Error(err, hashID.String())
+		}
+	}
+}
+
+func TestUnknownHash(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	assert.NoError(MiMC.Check())
+	assert.NoError(Poseidon.Check())
+	assert.ErrorIs(HashID(42).Check(), ErrUnknownHash)
+
+	circuit := hashCircuit{hashID: HashID(42), Data: make([]frontend.Variable, 1)}
+	err := test.IsSolved(&circuit, &hashCircuit{Data: []frontend.Variable{1}, Digest: 1}, ecc.BN254, backend.GROTH16)
+	assert.ErrorIs(err, ErrUnknownHash)
+}
+
+// TestPoseidonKAT checks the native and in-circuit Poseidon against known digests of
+// short inputs, the empty one included.
+func TestPoseidonKAT(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	for _, c := range []struct {
+		data   []fr.Element
+		digest string
+	}{
+		{nil, "2617418112184178912887221640635623318062913080160440159226227618343353282340"},
+		{[]fr.Element{fr.NewElement(1)}, "5137278684412802660768234190283062125189583659994691537102772582158346634760"},
+	} {
+		hfunc := Poseidon.New()
+		for i := range c.data {
+			hfunc.Write(c.data[i].Marshal())
+		}
+		var native fr.Element
+		native.SetBytes(hfunc.Sum(nil))
+		assert.Equal(c.digest, native.String(), len(c.data))
+
+		circuit := hashCircuit{hashID: Poseidon, Data: make([]frontend.Variable, len(c.data))}
+		assignment := hashCircuit{Data: make([]frontend.Variable, len(c.data)), Digest: c.digest}
+		for i := range c.data {
+			assignment.Data[i] = c.data[i]
+		}
+		err := test.IsSolved(&circuit, &assignment, ecc.BN254, backend.GROTH16)
+		assert.NoError(err, len(c.data))
+	}
+}
+
+func TestPoseidonLengthSeparation(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	var zero fr.Element
+	one := PoseidonSum(zero)
+	two := PoseidonSum(zero, zero)
+	assert.False(one.Equal(&two), "inputs of different lengths must not collide")
+}
+
+func TestCommitOpen(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	for _, hashID := range []HashID{MiMC, Poseidon} {
+		var data, r1, r2 fr.Element
+		_, err := data.SetRandom()
+		assert.NoError(err)
+		_, err = r1.SetRandom()
+		assert.NoError(err)
+		_, err = r2.SetRandom()
+		assert.NoError(err)
+
+		cm1 := hashID.Commit(r1, data)
+		cm2 := hashID.Commit(r2, data)
+		assert.NotEqual(cm1, cm2, "commitments to the same value must differ")
+
+		assert.True(hashID.Open(cm1, r1, data))
+		assert.False(hashID.Open(cm1, r2, data))
+		assert.False(hashID.Open(cm1, r1, r2))
+	}
+}
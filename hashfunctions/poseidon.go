@@ -0,0 +1,220 @@
+package hashfunctions
+
+import (
+	"hash"
+	"math/big"
+	"sync"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/frontend"
+	"golang.org/x/crypto/sha3"
+)
+
+// Poseidon instance over the BN254 scalar field with a width 3 state (rate 2,
+// capacity 1), x^5 S-box, 8 full rounds and 57 partial rounds.
+// Round constants are derived from a keccak chain over poseidonSeed, the same way
+// gnark-crypto derives the MiMC constants, and the MDS matrix is the Cauchy matrix
+// M[i][j] = 1/(i + (t+j)).
+const (
+	poseidonWidth         = 3
+	poseidonFullRounds    = 8
+	poseidonPartialRounds = 57
+	poseidonSeed          = "seed_poseidon_bn254"
+
+	blockSize = fr.Bytes
+)
+
+var (
+	poseidonConstants [(poseidonFullRounds + poseidonPartialRounds) * poseidonWidth]fr.Element
+	poseidonMDS       [poseidonWidth][poseidonWidth]fr.Element
+	poseidonOnce      sync.Once
+)
+
+func initPoseidonConstants() {
+	h := sha3.NewLegacyKeccak256()
+	h.Write([]byte(poseidonSeed))
+	rnd := h.Sum(nil)
+	for i := range poseidonConstants {
+		h.Reset()
+		h.Write(rnd)
+		rnd = h.Sum(nil)
+		poseidonConstants[i].SetBytes(rnd)
+	}
+
+	for i := 0; i < poseidonWidth; i++ {
+		for j := 0; j < poseidonWidth; j++ {
+			poseidonMDS[i][j].SetUint64(uint64(i + poseidonWidth + j))
+			poseidonMDS[i][j].Inverse(&poseidonMDS[i][j])
+		}
+	}
+}
+
+func poseidonIsFullRound(round int) bool {
+	half := poseidonFullRounds / 2
+	return round < half || round >= half+poseidonPartialRounds
+}
+
+// poseidonPermutation applies the Poseidon permutation to state in place.
+func poseidonPermutation(state *[poseidonWidth]fr.Element) {
+	poseidonOnce.Do(initPoseidonConstants)
+
+	for round := 0; round < poseidonFullRounds+poseidonPartialRounds; round++ {
+		for i := 0; i < poseidonWidth; i++ {
+			state[i].Add(&state[i], &poseidonConstants[round*poseidonWidth+i])
+		}
+
+		for i := 0; i < poseidonWidth; i++ {
+			if i > 0 && !poseidonIsFullRound(round) {
+				break
+			}
+			var tmp fr.Element
+			tmp.Square(&state[i]).Square(&tmp).Mul(&tmp, &state[i])
+			state[i].Set(&tmp)
+		}
+
+		var mixed [poseidonWidth]fr.Element
+		for i := 0; i < poseidonWidth; i++ {
+			for j := 0; j < poseidonWidth; j++ {
+				var tmp fr.Element
+				tmp.Mul(&poseidonMDS[i][j], &state[j])
+				mixed[i].Add(&mixed[i], &tmp)
+			}
+		}
+		*state = mixed
+	}
+}
+
+// PoseidonSum hashes a list of field elements with the Poseidon sponge.
+// The capacity element is initialised with the number of inputs, so inputs of
+// different lengths never collide through zero padding.
+func PoseidonSum(inputs ...fr.Element) fr.Element {
+	var state [poseidonWidth]fr.Element
+	state[0].SetUint64(uint64(len(inputs)))
+
+	rate := poseidonWidth - 1
+	for i := 0; i < len(inputs) || i == 0; i += rate {
+		for j := 0; j < rate && i+j < len(inputs); j++ {
+			state[j+1].Add(&state[j+1], &inputs[i+j])
+		}
+		poseidonPermutation(&state)
+	}
+
+	return state[1]
+}
+
+// poseidonDigest wraps PoseidonSum into a hash.Hash. Data is split in blocks of
+// 32 bytes, each block being read as a big endian field element, as for MiMC.
+type poseidonDigest struct {
+	data []byte
+}
+
+// NewPoseidon returns a native Poseidon hash.Hash, to be used wherever
+// hash.MIMC_BN254.New() was used (e.g. eddsa signatures).
+func NewPoseidon() hash.Hash {
+	return &poseidonDigest{}
+}
+
+func (d *poseidonDigest) Write(p []byte) (int, error) {
+	d.data = append(d.data, p...)
+	return len(p), nil
+}
+
+func (d *poseidonDigest) Sum(b []byte) []byte {
+	res := PoseidonSum(bytesToElements(d.data)...)
+	resB := res.Bytes()
+	return append(b, resB[:]...)
+}
+
+func (d *poseidonDigest) Reset() {
+	d.data = nil
+}
+
+func (d *poseidonDigest) Size() int {
+	return blockSize
+}
+
+func (d *poseidonDigest) BlockSize() int {
+	return blockSize
+}
+
+// bytesToElements splits data in field elements. A trailing incomplete block
+// is left padded with zeros, matching the padding of the native MiMC. Empty data gives
+// no element, as for the gadget.
+func bytesToElements(data []byte) []fr.Element {
+	res := make([]fr.Element, (len(data)+blockSize-1)/blockSize)
+	for i := range res {
+		end := (i + 1) * blockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		res[i].SetBytes(data[i*blockSize : end])
+	}
+	return res
+}
+
+// poseidonGadget is the in-circuit counterpart of poseidonDigest.
+type poseidonGadget struct {
+	api  frontend.API
+	data []frontend.Variable
+}
+
+func newPoseidonGadget(api frontend.API) *poseidonGadget {
+	poseidonOnce.Do(initPoseidonConstants)
+	return &poseidonGadget{api: api}
+}
+
+func (h *poseidonGadget) Write(data ...frontend.Variable) {
+	h.data = append(h.data, data...)
+}
+
+func (h *poseidonGadget) Reset() {
+	h.data = nil
+}
+
+func (h *poseidonGadget) Sum() frontend.Variable {
+	state := [poseidonWidth]frontend.Variable{len(h.data), 0, 0}
+
+	rate := poseidonWidth - 1
+	for i := 0; i < len(h.data) || i == 0; i += rate {
+		for j := 0; j < rate && i+j < len(h.data); j++ {
+			state[j+1] = h.api.Add(state[j+1], h.data[i+j])
+		}
+		h.permutation(&state)
+	}
+
+	return state[1]
+}
+
+func (h *poseidonGadget) permutation(state *[poseidonWidth]frontend.Variable) {
+	api := h.api
+
+	for round := 0; round < poseidonFullRounds+poseidonPartialRounds; round++ {
+		for i := 0; i < poseidonWidth; i++ {
+			state[i] = api.Add(state[i], toBigInt(&poseidonConstants[round*poseidonWidth+i]))
+		}
+
+		for i := 0; i < poseidonWidth; i++ {
+			if i > 0 && !poseidonIsFullRound(round) {
+				break
+			}
+			x2 := api.Mul(state[i], state[i])
+			x4 := api.Mul(x2, x2)
+			state[i] = api.Mul(x4, state[i])
+		}
+
+		var mixed [poseidonWidth]frontend.Variable
+		for i := 0; i < poseidonWidth; i++ {
+			mixed[i] = 0
+			for j := 0; j < poseidonWidth; j++ {
+				mixed[i] = api.Add(mixed[i], api.Mul(toBigInt(&poseidonMDS[i][j]), state[j]))
+			}
+		}
+		*state = mixed
+	}
+}
+
+func toBigInt(e *fr.Element) *big.Int {
+	var res big.Int
+	e.ToBigIntRegular(&res)
+	return &res
+}
@@ -0,0 +1,84 @@
+package hashtocurve
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/twistededwards"
+	edcircuit "github.com/consensys/gnark/std/algebra/twistededwards"
+)
+
+// HashToCurve deterministically maps tag to a point of the prime order subgroup of the
+// BN254 twisted Edwards curve, with unknown discrete log with respect to any other point.
+//
+// It uses try-and-increment: y = sha256(tag||counter) is tried until
+// a*x^2 + y^2 = 1 + d*x^2*y^2 has a solution, the root x that is not lexicographically
+// largest is kept and the cofactor is cleared. The number of iterations depends on the
+// tag, so the running time leaks information about it: it must not be used on secret inputs.
+func HashToCurve(tag []byte) twistededwards.PointAffine {
+	curve := twistededwards.GetEdwardsCurve()
+
+	var counter [4]byte
+	for i := uint32(0); ; i++ {
+		binary.BigEndian.PutUint32(counter[:], i)
+		h := sha256.New()
+		h.Write(tag)
+		h.Write(counter[:])
+
+		var p twistededwards.PointAffine
+		p.Y.SetBytes(h.Sum(nil))
+
+		// x^2 = (1 - y^2) / (a - d*y^2)
+		var one, num, den fr.Element
+		one.SetOne()
+		num.Square(&p.Y)
+		den.Mul(&num, &curve.D)
+		num.Sub(&one, &num)
+		den.Sub(&curve.A, &den)
+		if den.IsZero() {
+			continue
+		}
+		num.Div(&num, &den)
+		if num.Legendre() != 1 {
+			continue
+		}
+		p.X.Sqrt(&num)
+		if p.X.LexicographicallyLargest() {
+			p.X.Neg(&p.X)
+		}
+
+		ClearCofactor(&p)
+		if p.IsZero() {
+			continue
+		}
+		return p
+	}
+}
+
+// ClearCofactor multiplies p by the cofactor (8) of the curve.
+func ClearCofactor(p *twistededwards.PointAffine) {
+	p.Double(p).Double(p).Double(p)
+}
+
+// Generators derives n independent generators from a domain tag, the i-th one being
+// HashToCurve(tag||i).
+func Generators(tag string, n int) []twistededwards.PointAffine {
+	res := make([]twistededwards.PointAffine, n)
+	for i := range res {
+		var index [4]byte
+		binary.BigEndian.PutUint32(index[:], uint32(i))
+		res[i] = HashToCurve(append([]byte(tag), index[:]...))
+	}
+	return res
+}
+
+// Constant returns p as a circuit point whose coordinates are constants, so that a
+// generator computed off-circuit is baked into the constraint system.
+func Constant(p twistededwards.PointAffine) edcircuit.Point {
+	var x, y big.Int
+	p.X.ToBigIntRegular(&x)
+	p.Y.ToBigIntRegular(&y)
+	return edcircuit.Point{X: x, Y: y}
+}
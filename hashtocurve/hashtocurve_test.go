@@ -0,0 +1,97 @@
+package hashtocurve
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/twistededwards"
+	tedwards "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/frontend"
+	edcircuit "github.com/consensys/gnark/std/algebra/twistededwards"
+	"github.com/consensys/gnark/test"
+)
+
+func TestKnownAnswers(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	for _, kat := range []struct {
+		tag  string
+		x, y string
+	}{
+		{
+			"",
+			"10310317400233440671273621836402283642870018544328605930474567787021369085860",
+			"10810238093937353410561738815578521380963552691422342792074757763937122064158",
+		},
+		{
+			"ZKAT-VDP/pedersen/G",
+			"18141343118736519321477814074161443611931490659224672111342358095975502912319",
+			"85065788316713466324699344107695113983389405917296336601757505525010383785",
+		},
+		{
+			"ZKAT-VDP/pedersen/H",
+			"20042098567892655249412002250346887473780877367625204148448147198082232237556",
+			"18375188975736337630604763098179028374082266070632891518678763529663831425029",
+		},
+	} {
+		p := HashToCurve([]byte(kat.tag))
+		assert.Equal(kat.x, p.X.String(), kat.tag)
+		assert.Equal(kat.y, p.Y.String(), kat.tag)
+	}
+
+	g := Generators("ZKAT-VDP/test", 2)
+	assert.Equal("4720664700224542014352512315677505710175944646954886793222841923801942904648", g[1].X.String())
+	assert.Equal("11916337601929403775538058291905838614052721192880850456557228665395417880148", g[1].Y.String())
+}
+
+func TestPrimeOrderSubgroup(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	curve := twistededwards.GetEdwardsCurve()
+	points := Generators("ZKAT-VDP/test", 8)
+	for i, p := range points {
+		assert.True(p.IsOnCurve())
+		assert.False(p.IsZero())
+
+		var check twistededwards.PointAffine
+		check.ScalarMul(&p, &curve.Order)
+		assert.True(check.IsZero(), "generator must be in the prime order subgroup")
+
+		for j := 0; j < i; j++ {
+			assert.False(p.Equal(&points[j]), "generators must be distinct")
+		}
+	}
+}
+
+type constantCircuit struct {
+	Scalar frontend.Variable
+	Result edcircuit.Point `gnark:",public"`
+}
+
+func (circuit *constantCircuit) Define(api frontend.API) error {
+	curve, err := edcircuit.NewEdCurve(api, tedwards.BN254)
+	if err != nil {
+		return err
+	}
+	res := curve.ScalarMul(Constant(HashToCurve([]byte("ZKAT-VDP/test"))), circuit.Scalar)
+	api.AssertIsEqual(res.X, circuit.Result.X)
+	api.AssertIsEqual(res.Y, circuit.Result.Y)
+	return nil
+}
+
+func TestConstant(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	p := HashToCurve([]byte("ZKAT-VDP/test"))
+	s := big.NewInt(123456789)
+	var res twistededwards.PointAffine
+	res.ScalarMul(&p, s)
+
+	var circuit, assignment constantCircuit
+	assignment.Scalar = s
+	assignment.Result.X = res.X
+	assignment.Result.Y = res.Y
+	assert.NoError(test.IsSolved(&circuit, &assignment, ecc.BN254, backend.GROTH16))
+}
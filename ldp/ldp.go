@@ -28,3 +28,26 @@ func RandomResponse(rho fr.Element, msg *big.Int) (res big.Int, c0, c1 int) {
 	}
 	return
 }
+
+// RandomResponseBits applies RandomResponse to each of the nbBits bits of msg, the
+// i-th bit with the bits 2i and 2i+1 of rho as coins.
+func RandomResponseBits(rho fr.Element, msg *big.Int, nbBits int) (res []big.Int, c0, c1 []int) {
+	var coins big.Int
+	rho.ToBigIntRegular(&coins)
+
+	res = make([]big.Int, nbBits)
+	c0 = make([]int, nbBits)
+	c1 = make([]int, nbBits)
+	for i := 0; i < nbBits; i++ {
+		c0[i] = int(coins.Bit(2 * i))
+		c1[i] = int(coins.Bit(2*i + 1))
+
+		switch {
+		case c0[i] == 0:
+			res[i].SetUint64(uint64(msg.Bit(i)))
+		case c1[i] == 0:
+			res[i].SetInt64(1)
+		}
+	}
+	return
+}
@@ -38,3 +38,33 @@ func TestLDP(t *testing.T) {
 	// Output:
 	// Decryption succeeded: 1
 }
+
+func TestLDPBits(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	var rho fr.Element
+	_, err := rho.SetRandom()
+	assert.NoError(err)
+
+	const nbBits = 16
+	id := big.NewInt(0xbeef)
+	res, c0, c1 := RandomResponseBits(rho, id, nbBits)
+	assert.Equal(nbBits, len(res))
+
+	// the first bit uses the coins of RandomResponse
+	first, coin0, coin1 := RandomResponse(rho, big.NewInt(int64(id.Bit(0))))
+	assert.Equal(coin0, c0[0])
+	assert.Equal(coin1, c1[0])
+	assert.Equal(0, first.Cmp(&res[0]))
+
+	for i := range res {
+		switch {
+		case c0[i] == 0:
+			assert.Equal(int64(id.Bit(i)), res[i].Int64(), "bit %d is the bit of the ID", i)
+		case c1[i] == 0:
+			assert.Equal(int64(1), res[i].Int64(), "bit %d is forced to 1", i)
+		default:
+			assert.Equal(int64(0), res[i].Int64(), "bit %d is forced to 0", i)
+		}
+	}
+}
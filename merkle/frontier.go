@@ -0,0 +1,100 @@
+package merkle
+
+import (
+	"blockchain_DP/hashfunctions"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+)
+
+// Frontier is the compact form of Tree kept by a ledger: it only stores the
+// rightmost filled node of each level, which is enough to append leaves and
+// compute the root, but not to produce authentication paths.
+type Frontier struct {
+	hashID hashfunctions.HashID
+	depth  int
+	size   uint64
+
+	// filled[l] is the last left child written at level l
+	filled []fr.Element
+	zeros  []fr.Element
+	root   fr.Element
+}
+
+// NewFrontier creates the frontier of an empty tree of the given depth.
+func NewFrontier(h hashfunctions.HashID, depth int) (*Frontier, error) {
+	t, err := New(h, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Frontier{
+		hashID: h,
+		depth:  depth,
+		filled: make([]fr.Element, depth),
+		zeros:  t.zeros,
+		root:   t.zeros[depth],
+	}, nil
+}
+
+// RestoreFrontier rebuilds a frontier from the values returned by Nodes.
+func RestoreFrontier(h hashfunctions.HashID, size uint64, filled []fr.Element, root fr.Element) (*Frontier, error) {
+	f, err := NewFrontier(h, len(filled))
+	if err != nil {
+		return nil, err
+	}
+	if size > 1<<uint(f.depth) {
+		return nil, ErrTreeFull
+	}
+
+	f.size = size
+	copy(f.filled, filled)
+	f.root = root
+
+	return f, nil
+}
+
+func (f *Frontier) Depth() int {
+	return f.depth
+}
+
+// Size returns the number of leaves appended so far.
+func (f *Frontier) Size() uint64 {
+	return f.size
+}
+
+// Root returns the current root of the tree.
+func (f *Frontier) Root() fr.Element {
+	return f.root
+}
+
+// Nodes returns a copy of the filled nodes of each level, to be persisted.
+func (f *Frontier) Nodes() []fr.Element {
+	res := make([]fr.Element, f.depth)
+	copy(res, f.filled)
+	return res
+}
+
+// Append adds leaf to the tree and returns its index.
+func (f *Frontier) Append(leaf fr.Element) (uint64, error) {
+	index := f.size
+	if index>>uint(f.depth) != 0 {
+		return 0, ErrTreeFull
+	}
+
+	node := leaf
+	i := index
+	for l := 0; l < f.depth; l++ {
+		if i&1 == 0 {
+			f.filled[l] = node
+			node = Node(f.hashID, node, f.zeros[l])
+		} else {
+			node = Node(f.hashID, f.filled[l], node)
+		}
+		i >>= 1
+	}
+
+	f.root = node
+	f.size++
+
+	return index, nil
+}
@@ -0,0 +1,210 @@
+package merkle
+
+import (
+	"blockchain_DP/hashfunctions"
+	"errors"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/frontend"
+)
+
+var (
+	ErrTreeFull     = errors.New("merkle tree is full")
+	ErrUnknownLeaf  = errors.New("leaf index out of range")
+	ErrInvalidDepth = errors.New("invalid merkle tree depth")
+)
+
+// Tree is an append-only Merkle tree of fixed depth. Empty leaves are zero and
+// internal nodes are H(left||right).
+type Tree struct {
+	hashID hashfunctions.HashID
+	depth  int
+
+	// nodes[0] are the leaves, nodes[depth] is the root
+	nodes [][]fr.Element
+	// zeros[l] is the root of an empty subtree of height l
+	zeros []fr.Element
+}
+
+// Path is the authentication path of a leaf: its index and the siblings from the leaf to the root.
+type Path struct {
+	Index    uint64
+	Siblings []fr.Element
+}
+
+// New creates an empty tree of the given depth, holding up to 2^depth leaves.
+func New(h hashfunctions.HashID, depth int) (*Tree, error) {
+	if err := h.Check(); err != nil {
+		return nil, err
+	}
+	if depth <= 0 || depth > 63 {
+		return nil, ErrInvalidDepth
+	}
+
+	t := &Tree{
+		hashID: h,
+		depth:  depth,
+		nodes:  make([][]fr.Element, depth+1),
+		zeros:  make([]fr.Element, depth+1),
+	}
+	for l := 1; l <= depth; l++ {
+		t.zeros[l] = Node(h, t.zeros[l-1], t.zeros[l-1])
+	}
+
+	return t, nil
+}
+
+// Node computes the parent H(left||right) of two nodes.
+func Node(h hashfunctions.HashID, left, right fr.Element) (res fr.Element) {
+	hfunc := h.New()
+	hfunc.Write(left.Marshal())
+	hfunc.Write(right.Marshal())
+	res.SetBytes(hfunc.Sum(nil))
+	return res
+}
+
+func (t *Tree) Depth() int {
+	return t.depth
+}
+
+// Size returns the number of leaves appended so far.
+func (t *Tree) Size() uint64 {
+	return uint64(len(t.nodes[0]))
+}
+
+// Root returns the current root of the tree.
+func (t *Tree) Root() fr.Element {
+	if len(t.nodes[t.depth]) == 0 {
+		return t.zeros[t.depth]
+	}
+	return t.nodes[t.depth][0]
+}
+
+// Append adds leaf to the tree and returns its index.
+func (t *Tree) Append(leaf fr.Element) (uint64, error) {
+	index := t.Size()
+	if index>>uint(t.depth) != 0 {
+		return 0, ErrTreeFull
+	}
+
+	t.nodes[0] = append(t.nodes[0], leaf)
+
+	// update the ancestors of the new leaf
+	i := index
+	for l := 0; l < t.depth; l++ {
+		left, right := t.node(l, i&^1), t.node(l, i|1)
+		parent := Node(t.hashID, left, right)
+
+		i >>= 1
+		if i < uint64(len(t.nodes[l+1])) {
+			t.nodes[l+1][i] = parent
+		} else {
+			t.nodes[l+1] = append(t.nodes[l+1], parent)
+		}
+	}
+
+	return index, nil
+}
+
+// Path returns the authentication path of the leaf at index.
+func (t *Tree) Path(index uint64) (Path, error) {
+	if index >= t.Size() {
+		return Path{}, ErrUnknownLeaf
+	}
+
+	p := Path{Index: index, Siblings: make([]fr.Element, t.depth)}
+	i := index
+	for l := 0; l < t.depth; l++ {
+		p.Siblings[l] = t.node(l, i^1)
+		i >>= 1
+	}
+
+	return p, nil
+}
+
+// Leaf returns the leaf at index.
+func (t *Tree) Leaf(index uint64) (fr.Element, error) {
+	if index >= t.Size() {
+		return fr.Element{}, ErrUnknownLeaf
+	}
+	return t.nodes[0][index], nil
+}
+
+func (t *Tree) node(level int, i uint64) fr.Element {
+	if i < uint64(len(t.nodes[level])) {
+		return t.nodes[level][i]
+	}
+	return t.zeros[level]
+}
+
+// Root computes the root of the tree from leaf and its authentication path.
+func (p *Path) Root(h hashfunctions.HashID, leaf fr.Element) fr.Element {
+	node := leaf
+	for l := range p.Siblings {
+		if (p.Index>>uint(l))&1 == 0 {
+			node = Node(h, node, p.Siblings[l])
+		} else {
+			node = Node(h, p.Siblings[l], node)
+		}
+	}
+	return node
+}
+
+// Verify checks that leaf belongs to the tree of the given root.
+func (p *Path) Verify(h hashfunctions.HashID, root, leaf fr.Element) bool {
+	res := p.Root(h, leaf)
+	return res.Equal(&root)
+}
+
+// CircuitPath is the in-circuit authentication path of a leaf.
+type CircuitPath struct {
+	Index    frontend.Variable
+	Siblings []frontend.Variable
+}
+
+// NewCircuitPath allocates the path of a tree of the given depth, to be used
+// when declaring a circuit.
+func NewCircuitPath(depth int) CircuitPath {
+	return CircuitPath{Siblings: make([]frontend.Variable, depth)}
+}
+
+// Assign returns the circuit assignment of the path.
+func (p *Path) Assign() CircuitPath {
+	res := CircuitPath{Index: p.Index, Siblings: make([]frontend.Variable, len(p.Siblings))}
+	for i := range p.Siblings {
+		res.Siblings[i] = p.Siblings[i]
+	}
+	return res
+}
+
+// ComputeRoot is the gadget computing the root of the tree from leaf and its path.
+func (p *CircuitPath) ComputeRoot(api frontend.API, h hashfunctions.HashID, leaf frontend.Variable) (frontend.Variable, error) {
+
+	hfunc, err := h.NewGadget(api)
+	if err != nil {
+		return nil, err
+	}
+
+	bits := api.ToBinary(p.Index, len(p.Siblings))
+	node := leaf
+	for l := range p.Siblings {
+		left := api.Select(bits[l], p.Siblings[l], node)
+		right := api.Select(bits[l], node, p.Siblings[l])
+
+		hfunc.Reset()
+		hfunc.Write(left, right)
+		node = hfunc.Sum()
+	}
+
+	return node, nil
+}
+
+// AssertMembership is the gadget checking that leaf belongs to the tree of the given root.
+func (p *CircuitPath) AssertMembership(api frontend.API, h hashfunctions.HashID, root, leaf frontend.Variable) error {
+	res, err := p.ComputeRoot(api, h, leaf)
+	if err != nil {
+		return err
+	}
+	api.AssertIsEqual(res, root)
+	return nil
+}
@@ -0,0 +1,144 @@
+package merkle
+
+import (
+	"blockchain_DP/hashfunctions"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+)
+
+type membershipCircuit struct {
+	hashID hashfunctions.HashID
+	Root   frontend.Variable `gnark:",public"`
+	Leaf   frontend.Variable
+	Path   CircuitPath
+}
+
+func (circuit *membershipCircuit) Define(api frontend.API) error {
+	return circuit.Path.AssertMembership(api, circuit.hashID, circuit.Root, circuit.Leaf)
+}
+
+func TestTree(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	const depth = 4
+	tree, err := New(hashfunctions.MiMC, depth)
+	assert.NoError(err)
+
+	// the root of the empty tree is the root of zero leaves
+	var zero fr.Element
+	emptyRoot := tree.Root()
+	full := make([]fr.Element, 1<<depth)
+	for len(full) > 1 {
+		next := make([]fr.Element, len(full)/2)
+		for i := range next {
+			next[i] = Node(hashfunctions.MiMC, full[2*i], full[2*i+1])
+		}
+		full = next
+	}
+	assert.True(emptyRoot.Equal(&full[0]))
+
+	leaves := make([]fr.Element, 5)
+	for i := range leaves {
+		_, err := leaves[i].SetRandom()
+		assert.NoError(err)
+		index, err := tree.Append(leaves[i])
+		assert.NoError(err)
+		assert.Equal(uint64(i), index)
+
+		// every leaf appended so far has a valid path to the current root
+		for j := 0; j <= i; j++ {
+			path, err := tree.Path(uint64(j))
+			assert.NoError(err)
+			assert.True(path.Verify(hashfunctions.MiMC, tree.Root(), leaves[j]))
+			assert.False(path.Verify(hashfunctions.MiMC, tree.Root(), zero))
+		}
+	}
+
+	_, err = tree.Path(5)
+	assert.ErrorIs(err, ErrUnknownLeaf)
+
+	for tree.Size() < 1<<depth {
+		_, err = tree.Append(zero)
+		assert.NoError(err)
+	}
+	_, err = tree.Append(zero)
+	assert.ErrorIs(err, ErrTreeFull)
+
+	_, err = New(hashfunctions.HashID(42), depth)
+	assert.ErrorIs(err, hashfunctions.ErrUnknownHash)
+}
+
+func TestMembershipGadget(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	const depth = 8
+	for _, hashID := range []hashfunctions.HashID{hashfunctions.MiMC, hashfunctions.Poseidon} {
+		tree, err := New(hashID, depth)
+		assert.NoError(err)
+
+		leaves := make([]fr.Element, 3)
+		for i := range leaves {
+			_, err := leaves[i].SetRandom()
+			assert.NoError(err)
+			_, err = tree.Append(leaves[i])
+			assert.NoError(err)
+		}
+
+		path, err := tree.Path(1)
+		assert.NoError(err)
+
+		var circuit, assignment membershipCircuit
+		circuit.hashID = hashID
+		circuit.Path = NewCircuitPath(depth)
+		assignment.Root = tree.Root()
+		assignment.Leaf = leaves[1]
+		assignment.Path = path.Assign()
+
+		err = test.IsSolved(&circuit, &assignment, ecc.BN254, backend.GROTH16)
+		assert.NoError(err, hashID.String())
+
+		// a leaf that is not in the tree is rejected
+		assignment.Leaf = leaves[2]
+		err = test.IsSolved(&circuit, &assignment, ecc.BN254, backend.GROTH16)
+		assert.Error(err, hashID.String())
+	}
+}
+
+func TestFrontier(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	const depth = 5
+	tree, err := New(hashfunctions.MiMC, depth)
+	assert.NoError(err)
+	frontier, err := NewFrontier(hashfunctions.MiMC, depth)
+	assert.NoError(err)
+
+	for i := 0; i < 1<<depth; i++ {
+		var leaf fr.Element
+		_, err := leaf.SetRandom()
+		assert.NoError(err)
+
+		_, err = tree.Append(leaf)
+		assert.NoError(err)
+		_, err = frontier.Append(leaf)
+		assert.NoError(err)
+
+		// the frontier computes the same roots as the full tree
+		treeRoot, frontierRoot := tree.Root(), frontier.Root()
+		assert.True(treeRoot.Equal(&frontierRoot))
+
+		// and can be restored from its persisted nodes
+		restored, err := RestoreFrontier(hashfunctions.MiMC, frontier.Size(), frontier.Nodes(), frontier.Root())
+		assert.NoError(err)
+		assert.Equal(frontier, restored)
+	}
+
+	var leaf fr.Element
+	_, err = frontier.Append(leaf)
+	assert.ErrorIs(err, ErrTreeFull)
+}
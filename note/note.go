@@ -0,0 +1,74 @@
+package note
+
+import (
+	"blockchain_DP/hashfunctions"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/frontend"
+)
+
+// Note is a Zerocash coin: the address a_pk of its owner, its value,
+// the nonce rho (omega in the xi circuit) from which its serial number is derived,
+// and the randomness r of its commitment cm = COMM(note).
+type Note struct {
+	Apk   fr.Element
+	Value uint64
+	Rho   fr.Element
+	R     fr.Element
+}
+
+// New creates a note of value for the address apk, with fresh rho and r.
+func New(apk fr.Element, value uint64) (Note, error) {
+	n := Note{Apk: apk, Value: value}
+	if _, err := n.Rho.SetRandom(); err != nil {
+		return Note{}, err
+	}
+	if _, err := n.R.SetRandom(); err != nil {
+		return Note{}, err
+	}
+	return n, nil
+}
+
+// Commitment computes cm = H(a_pk||value||rho||r).
+func (n *Note) Commitment(h hashfunctions.HashID) []byte {
+	var value fr.Element
+	value.SetUint64(n.Value)
+	return h.Commit(n.R, n.Apk, value, n.Rho)
+}
+
+// SerialNumber computes sn = PRF_sn(a_sk, rho). ask must be the key the note was sent to.
+func (n *Note) SerialNumber(h hashfunctions.HashID, ask fr.Element) fr.Element {
+	return h.PRFSN(ask, n.Rho)
+}
+
+// Address computes a_pk = PRF_addr(a_sk) = H(a_sk||0).
+func Address(h hashfunctions.HashID, ask fr.Element) (apk fr.Element) {
+	var zero fr.Element
+
+	hfunc := h.New()
+	hfunc.Write(ask.Marshal())
+	hfunc.Write(zero.Marshal())
+	apk.SetBytes(hfunc.Sum(nil))
+
+	return apk
+}
+
+// CommitmentGadget is the gadget computing cm = H(a_pk||value||rho||r).
+func CommitmentGadget(api frontend.API, h hashfunctions.HashID, apk, value, rho, r frontend.Variable) (frontend.Variable, error) {
+	return hashfunctions.CommitGadget(api, h, r, apk, value, rho)
+}
+
+// AssertCommitment is the gadget checking that cm = H(a_pk||value||rho||r).
+func AssertCommitment(api frontend.API, h hashfunctions.HashID, cm, apk, value, rho, r frontend.Variable) error {
+	return hashfunctions.AssertCommitment(api, h, cm, r, apk, value, rho)
+}
+
+// PRFAddr is the gadget computing a_pk = H(a_sk||0).
+func PRFAddr(api frontend.API, h hashfunctions.HashID, ask frontend.Variable) (frontend.Variable, error) {
+	hfunc, err := h.NewGadget(api)
+	if err != nil {
+		return nil, err
+	}
+	hfunc.Write(ask, 0)
+	return hfunc.Sum(), nil
+}
@@ -0,0 +1,62 @@
+package note
+
+import (
+	"blockchain_DP/hashfunctions"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+)
+
+type noteCircuit struct {
+	hashID hashfunctions.HashID
+	CM     frontend.Variable `gnark:",public"`
+	Ask    frontend.Variable
+	Value  frontend.Variable
+	Rho    frontend.Variable
+	R      frontend.Variable
+}
+
+func (circuit *noteCircuit) Define(api frontend.API) error {
+	apk, err := PRFAddr(api, circuit.hashID, circuit.Ask)
+	if err != nil {
+		return err
+	}
+	return AssertCommitment(api, circuit.hashID, circuit.CM, apk, circuit.Value, circuit.Rho, circuit.R)
+}
+
+func TestNoteCommitment(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	for _, hashID := range []hashfunctions.HashID{hashfunctions.MiMC, hashfunctions.Poseidon} {
+		var ask fr.Element
+		_, err := ask.SetRandom()
+		assert.NoError(err)
+
+		n, err := New(Address(hashID, ask), 42)
+		assert.NoError(err)
+
+		var circuit, assignment noteCircuit
+		circuit.hashID = hashID
+		assignment.CM = n.Commitment(hashID)
+		assignment.Ask = ask
+		assignment.Value = n.Value
+		assignment.Rho = n.Rho
+		assignment.R = n.R
+
+		err = test.IsSolved(&circuit, &assignment, ecc.BN254, backend.GROTH16)
+		assert.NoError(err, hashID.String())
+
+		// the commitment binds the value of the note
+		assignment.Value = n.Value + 1
+		err = test.IsSolved(&circuit, &assignment, ecc.BN254, backend.GROTH16)
+		assert.Error(err, hashID.String())
+
+		sn := n.SerialNumber(hashID, ask)
+		expected := hashID.PRFSN(ask, n.Rho)
+		assert.True(sn.Equal(&expected))
+	}
+}
@@ -0,0 +1,71 @@
+package pedersen
+
+import (
+	"blockchain_DP/hashtocurve"
+	"math/big"
+	"sync"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/twistededwards"
+	"github.com/consensys/gnark/frontend"
+	edcircuit "github.com/consensys/gnark/std/algebra/twistededwards"
+)
+
+// Domain separation tags of the two generators. Their discrete logs with respect to
+// each other (and to the curve base point) are unknown, since they are derived by
+// hashing to the curve.
+const (
+	tagG = "ZKAT-VDP/pedersen/G"
+	tagH = "ZKAT-VDP/pedersen/H"
+)
+
+var (
+	genG, genH twistededwards.PointAffine
+	genOnce    sync.Once
+)
+
+func initGenerators() {
+	genG = hashtocurve.HashToCurve([]byte(tagG))
+	genH = hashtocurve.HashToCurve([]byte(tagH))
+}
+
+// Generators returns the generators (G, H) of the commitment scheme.
+func Generators() (G, H twistededwards.PointAffine) {
+	genOnce.Do(initGenerators)
+	return genG, genH
+}
+
+// Commit computes the commitment cm = v*G + r*H.
+// r must be sampled uniformly at random in [0, Order), e.g. with elgamal.GenScalar.
+func Commit(v, r *big.Int) (cm twistededwards.PointAffine) {
+	G, H := Generators()
+
+	var vG, rH twistededwards.PointAffine
+	vG.ScalarMul(&G, v)
+	rH.ScalarMul(&H, r)
+	cm.Add(&vG, &rH)
+
+	return
+}
+
+// Add returns the commitment to (v1+v2, r1+r2) from commitments to (v1, r1) and (v2, r2).
+func Add(cm1, cm2 twistededwards.PointAffine) (cm twistededwards.PointAffine) {
+	cm.Add(&cm1, &cm2)
+	return
+}
+
+// Verify checks that (v, r) is an opening of cm.
+func Verify(cm twistededwards.PointAffine, v, r *big.Int) bool {
+	res := Commit(v, r)
+	return res.Equal(&cm)
+}
+
+// AssertOpening is the gadget proving knowledge of an opening (v, r) of cm.
+// The generators are baked into the circuit as constants.
+func AssertOpening(curve edcircuit.Curve, cm edcircuit.Point, v, r frontend.Variable) {
+	G, H := Generators()
+
+	res := curve.DoubleBaseScalarMul(hashtocurve.Constant(G), hashtocurve.Constant(H), v, r)
+
+	curve.API().AssertIsEqual(res.X, cm.X)
+	curve.API().AssertIsEqual(res.Y, cm.Y)
+}
@@ -0,0 +1,82 @@
+package pedersen
+
+import (
+	"blockchain_DP/elgamal"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/twistededwards"
+	tedwards "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/frontend"
+	edcircuit "github.com/consensys/gnark/std/algebra/twistededwards"
+	"github.com/consensys/gnark/test"
+)
+
+type openingCircuit struct {
+	CM edcircuit.Point `gnark:",public"`
+	V  frontend.Variable
+	R  frontend.Variable
+}
+
+func (circuit *openingCircuit) Define(api frontend.API) error {
+	curve, err := edcircuit.NewEdCurve(api, tedwards.BN254)
+	if err != nil {
+		return err
+	}
+	AssertOpening(curve, circuit.CM, circuit.V, circuit.R)
+	return nil
+}
+
+func TestCommitAddVerify(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	G, H := Generators()
+	c := twistededwards.GetEdwardsCurve()
+	assert.True(G.IsOnCurve() && H.IsOnCurve())
+	assert.False(G.Equal(&H))
+	assert.False(G.Equal(&c.Base))
+
+	// the generators are in the prime order subgroup
+	var check twistededwards.PointAffine
+	check.ScalarMul(&G, &c.Order)
+	assert.True(check.IsZero())
+	check.ScalarMul(&H, &c.Order)
+	assert.True(check.IsZero())
+
+	v1, v2 := big.NewInt(40), big.NewInt(2)
+	r1, r2 := elgamal.GenScalar(&c.Order), elgamal.GenScalar(&c.Order)
+
+	cm1 := Commit(v1, r1)
+	cm2 := Commit(v2, r2)
+	assert.True(Verify(cm1, v1, r1))
+	assert.False(Verify(cm1, v2, r1))
+
+	var v, r big.Int
+	v.Add(v1, v2)
+	r.Add(r1, r2).Mod(&r, &c.Order)
+	assert.True(Verify(Add(cm1, cm2), &v, &r), "commitments are additively homomorphic")
+}
+
+func TestAssertOpening(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	c := twistededwards.GetEdwardsCurve()
+	v := big.NewInt(1000)
+	r := elgamal.GenScalar(&c.Order)
+	cm := Commit(v, r)
+
+	var circuit, assignment openingCircuit
+	assignment.CM.X = cm.X
+	assignment.CM.Y = cm.Y
+	assignment.V = v
+	assignment.R = r
+
+	err := test.IsSolved(&circuit, &assignment, ecc.BN254, backend.GROTH16)
+	assert.NoError(err)
+
+	assignment.V = big.NewInt(1001)
+	err = test.IsSolved(&circuit, &assignment, ecc.BN254, backend.GROTH16)
+	assert.Error(err)
+}
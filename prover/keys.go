@@ -0,0 +1,236 @@
+package prover
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/kzg"
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/frontend"
+)
+
+const (
+	ccsFile = "circuit.ccs"
+	pkFile  = "proving.key"
+	vkFile  = "verifying.key"
+
+	fingerprintDomain = "ZKAT-VDP/circuit"
+)
+
+var (
+	ErrFingerprintMismatch = errors.New("key was generated for another circuit")
+	ErrSRSMismatch         = errors.New("key was generated with another SRS")
+	ErrCorruptedKey        = errors.New("key does not match its checksum")
+)
+
+// Fingerprint identifies the version and shape of a compiled circuit (e.g. the number of
+// inputs of the xi circuit, the tree depth or the hash function): it is the sha256 of
+// its serialized constraint system.
+func Fingerprint(ccs frontend.CompiledConstraintSystem) ([]byte, error) {
+	h := sha256.New()
+	h.Write([]byte(fingerprintDomain))
+	if _, err := ccs.WriteTo(h); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// WriteKeys writes the constraint system and the keys in dir. Each file starts with
+// the fingerprint of the circuit and the sha256 of the object it holds. The PLONK
+// proving key is not written, as ReadKeys recomputes it.
+func WriteKeys(dir string, keys *Keys) error {
+	fingerprint, err := Fingerprint(keys.CCS)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	objects := map[string]io.WriterTo{
+		ccsFile: keys.CCS,
+		pkFile:  keys.PK,
+		vkFile:  keys.VK,
+	}
+	if keys.Backend == backend.PLONK {
+		delete(objects, pkFile)
+	}
+	for name, object := range objects {
+		if err = writeFile(filepath.Join(dir, name), fingerprint, object); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadKeys reads the constraint system and keys written by WriteKeys, and checks they
+// were generated for circuit. The options must select the backend the keys were
+// set up for (and the SRS for PLONK).
+func ReadKeys(dir string, circuit frontend.Circuit, opts ...Option) (*Keys, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint, err := circuitFingerprint(circuit, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.backend == backend.PLONK {
+		return readPlonkKeys(dir, fingerprint, cfg.srs)
+	}
+
+	keys := &Keys{
+		Backend: backend.GROTH16,
+		CCS:     groth16.NewCS(ecc.BN254),
+		PK:      groth16.NewProvingKey(ecc.BN254),
+		VK:      groth16.NewVerifyingKey(ecc.BN254),
+	}
+	for name, object := range map[string]io.ReaderFrom{
+		ccsFile: keys.CCS,
+		pkFile:  keys.PK,
+		vkFile:  keys.VK,
+	} {
+		if err = readFile(filepath.Join(dir, name), fingerprint, object); err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
+
+// readPlonkKeys recomputes the PLONK keys from the stored constraint system, as the
+// keys read back by gnark lack the evaluations of the permutation (proving key) and
+// the coset shift (verifying key). The PLONK setup is deterministic given the SRS:
+// the result must match the stored verifying key.
+func readPlonkKeys(dir string, fingerprint []byte, srs kzg.SRS) (*Keys, error) {
+	ccs := plonk.NewCS(ecc.BN254)
+	if err := readFile(filepath.Join(dir, ccsFile), fingerprint, ccs); err != nil {
+		return nil, err
+	}
+	stored := plonk.NewVerifyingKey(ecc.BN254)
+	if err := readFile(filepath.Join(dir, vkFile), fingerprint, stored); err != nil {
+		return nil, err
+	}
+
+	pk, vk, err := plonk.Setup(ccs, srs)
+	if err != nil {
+		return nil, err
+	}
+
+	var expected, actual bytes.Buffer
+	if _, err = stored.WriteTo(&expected); err != nil {
+		return nil, err
+	}
+	if _, err = vk.WriteTo(&actual); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(expected.Bytes(), actual.Bytes()) {
+		return nil, ErrSRSMismatch
+	}
+
+	return &Keys{Backend: backend.PLONK, CCS: ccs, PK: pk, VK: vk}, nil
+}
+
+// ReadVerifyingKey reads the verifying key written by WriteKeys, and checks it was
+// generated for circuit.
+func ReadVerifyingKey(dir string, circuit frontend.Circuit, opts ...Option) (VerifyingKey, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint, err := circuitFingerprint(circuit, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.backend == backend.PLONK {
+		keys, err := readPlonkKeys(dir, fingerprint, cfg.srs)
+		if err != nil {
+			return nil, err
+		}
+		return keys.VK, nil
+	}
+
+	vk := groth16.NewVerifyingKey(ecc.BN254)
+	if err = readFile(filepath.Join(dir, vkFile), fingerprint, vk); err != nil {
+		return nil, err
+	}
+	return vk, nil
+}
+
+func circuitFingerprint(circuit frontend.Circuit, opts []Option) ([]byte, error) {
+	ccs, err := Compile(circuit, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return Fingerprint(ccs)
+}
+
+// writeFile writes fingerprint||sha256(object)||object to path.
+func writeFile(path string, fingerprint []byte, object io.WriterTo) error {
+	var buf bytes.Buffer
+	if _, err := object.WriteTo(&buf); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	if _, err = w.Write(fingerprint); err == nil {
+		if _, err = w.Write(sum[:]); err == nil {
+			if _, err = buf.WriteTo(w); err == nil {
+				err = w.Flush()
+			}
+		}
+	}
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
+
+func readFile(path string, fingerprint []byte, object io.ReaderFrom) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	stored := make([]byte, len(fingerprint))
+	if _, err = io.ReadFull(r, stored); err != nil {
+		return err
+	}
+	if !bytes.Equal(stored, fingerprint) {
+		return ErrFingerprintMismatch
+	}
+
+	var sum [sha256.Size]byte
+	if _, err = io.ReadFull(r, sum[:]); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if sha256.Sum256(data) != sum {
+		return ErrCorruptedKey
+	}
+
+	_, err = object.ReadFrom(bytes.NewReader(data))
+	return err
+}
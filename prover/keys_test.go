@@ -0,0 +1,120 @@
+package prover
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+)
+
+// sumCircuit has a shape depending on its number of inputs, as the xi circuit does.
+type sumCircuit struct {
+	X   []frontend.Variable
+	Sum frontend.Variable `gnark:",public"`
+}
+
+func (circuit *sumCircuit) Define(api frontend.API) error {
+	var sum frontend.Variable = 0
+	for i := range circuit.X {
+		sum = api.Add(sum, api.Mul(circuit.X[i], circuit.X[i]))
+	}
+	api.AssertIsEqual(sum, circuit.Sum)
+	return nil
+}
+
+func newSumCircuit(n int) *sumCircuit {
+	return &sumCircuit{X: make([]frontend.Variable, n)}
+}
+
+func TestKeysPersistence(t *testing.T) {
+	assert := test.NewAssert(t)
+	dir := t.TempDir()
+
+	ccs, err := Compile(newSumCircuit(2))
+	assert.NoError(err)
+	keys, err := Setup(ccs)
+	assert.NoError(err)
+	assert.NoError(WriteKeys(dir, keys))
+
+	// the fingerprint only depends on the circuit shape
+	fingerprint, err := Fingerprint(ccs)
+	assert.NoError(err)
+	ccs2, err := Compile(newSumCircuit(2))
+	assert.NoError(err)
+	fingerprint2, err := Fingerprint(ccs2)
+	assert.NoError(err)
+	assert.Equal(fingerprint, fingerprint2)
+
+	loaded, err := ReadKeys(dir, newSumCircuit(2))
+	assert.NoError(err)
+
+	assignment := &sumCircuit{X: []frontend.Variable{3, 4}, Sum: 25}
+	proof, err := Prove(loaded, assignment)
+	assert.NoError(err)
+
+	vk, err := ReadVerifyingKey(dir, newSumCircuit(2))
+	assert.NoError(err)
+	publicWitness, err := PublicWitness(assignment)
+	assert.NoError(err)
+	assert.NoError(Verify(vk, proof, publicWitness))
+	assert.NoError(Verify(keys.VK, proof, publicWitness))
+
+	// keys of a circuit with another number of inputs are refused
+	_, err = ReadVerifyingKey(dir, newSumCircuit(3))
+	assert.ErrorIs(err, ErrFingerprintMismatch)
+	_, err = ReadKeys(dir, newSumCircuit(1))
+	assert.ErrorIs(err, ErrFingerprintMismatch)
+
+	// a key altered after the header is refused
+	path := filepath.Join(dir, pkFile)
+	buf, err := os.ReadFile(path)
+	assert.NoError(err)
+	buf[len(buf)-1] ^= 1
+	assert.NoError(os.WriteFile(path, buf, 0o644))
+	_, err = ReadKeys(dir, newSumCircuit(2))
+	assert.ErrorIs(err, ErrCorruptedKey)
+}
+
+func TestPlonkKeysPersistence(t *testing.T) {
+	assert := test.NewAssert(t)
+	dir := t.TempDir()
+
+	ccs, err := Compile(newSumCircuit(2), WithBackend(backend.PLONK))
+	assert.NoError(err)
+	srs, err := NewUnsafeSRS(SRSSize(ccs))
+	assert.NoError(err)
+	keys, err := Setup(ccs, WithBackend(backend.PLONK), WithSRS(srs))
+	assert.NoError(err)
+	assert.NoError(WriteKeys(dir, keys))
+
+	// the proving key is recomputed, not stored
+	_, err = os.Stat(filepath.Join(dir, pkFile))
+	assert.True(os.IsNotExist(err))
+
+	// the keys are bound to the backend they were set up for
+	_, err = ReadKeys(dir, newSumCircuit(2))
+	assert.ErrorIs(err, ErrFingerprintMismatch)
+	_, err = ReadKeys(dir, newSumCircuit(2), WithBackend(backend.PLONK))
+	assert.ErrorIs(err, ErrNoSRS)
+
+	loaded, err := ReadKeys(dir, newSumCircuit(2), WithBackend(backend.PLONK), WithSRS(srs))
+	assert.NoError(err)
+
+	assignment := &sumCircuit{X: []frontend.Variable{3, 4}, Sum: 25}
+	proof, err := Prove(loaded, assignment)
+	assert.NoError(err)
+
+	vk, err := ReadVerifyingKey(dir, newSumCircuit(2), WithBackend(backend.PLONK), WithSRS(srs))
+	assert.NoError(err)
+	publicWitness, err := PublicWitness(assignment)
+	assert.NoError(err)
+	assert.NoError(Verify(vk, proof, publicWitness))
+
+	other, err := NewUnsafeSRS(SRSSize(ccs))
+	assert.NoError(err)
+	_, err = ReadKeys(dir, newSumCircuit(2), WithBackend(backend.PLONK), WithSRS(other))
+	assert.ErrorIs(err, ErrSRSMismatch)
+}
@@ -0,0 +1,171 @@
+package prover
+
+import (
+	"errors"
+	"io"
+	"reflect"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/kzg"
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/frontend/cs/scs"
+)
+
+var (
+	ErrUnknownBackend = errors.New("unknown proving backend")
+	ErrNoSRS          = errors.New("PLONK requires a KZG SRS")
+	ErrBackend        = errors.New("keys and proof are for different backends")
+)
+
+type config struct {
+	backend backend.ID
+	srs     kzg.SRS
+}
+
+// Option configures the backend used to compile, set up, prove and verify.
+type Option func(*config)
+
+// WithBackend selects the proving backend: backend.GROTH16 (the default) or backend.PLONK.
+func WithBackend(id backend.ID) Option {
+	return func(cfg *config) {
+		cfg.backend = id
+	}
+}
+
+// WithSRS sets the KZG SRS of the PLONK backend. The same SRS serves every circuit
+// smaller than it.
+func WithSRS(srs kzg.SRS) Option {
+	return func(cfg *config) {
+		cfg.srs = srs
+	}
+}
+
+func newConfig(opts []Option) (config, error) {
+	cfg := config{backend: backend.GROTH16}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	switch cfg.backend {
+	case backend.GROTH16:
+	case backend.PLONK:
+		if cfg.srs == nil {
+			return cfg, ErrNoSRS
+		}
+	default:
+		return cfg, ErrUnknownBackend
+	}
+	return cfg, nil
+}
+
+// ProvingKey is a groth16.ProvingKey or a plonk.ProvingKey.
+type ProvingKey interface {
+	io.WriterTo
+	io.ReaderFrom
+}
+
+// VerifyingKey is a groth16.VerifyingKey or a plonk.VerifyingKey.
+type VerifyingKey interface {
+	io.WriterTo
+	io.ReaderFrom
+}
+
+// Proof is a groth16.Proof or a plonk.Proof.
+type Proof interface {
+	io.WriterTo
+	io.ReaderFrom
+}
+
+// Keys holds a compiled circuit together with its proving and verifying keys.
+type Keys struct {
+	Backend backend.ID
+	CCS     frontend.CompiledConstraintSystem
+	PK      ProvingKey
+	VK      VerifyingKey
+}
+
+// Compile compiles circuit (e.g. xicircuit.NewXiCircuit(n)) over BN254, with the
+// r1cs builder for groth16 and the scs builder for PLONK.
+func Compile(circuit frontend.Circuit, opts ...Option) (frontend.CompiledConstraintSystem, error) {
+	cfg := config{backend: backend.GROTH16}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	switch cfg.backend {
+	case backend.GROTH16:
+		return frontend.Compile(ecc.BN254, r1cs.NewBuilder, circuit)
+	case backend.PLONK:
+		return frontend.Compile(ecc.BN254, scs.NewBuilder, circuit)
+	default:
+		return nil, ErrUnknownBackend
+	}
+}
+
+// Setup runs the setup of a compiled circuit: the circuit specific groth16 setup, or
+// the PLONK preprocessing of the circuit against the SRS.
+func Setup(ccs frontend.CompiledConstraintSystem, opts ...Option) (*Keys, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := &Keys{Backend: cfg.backend, CCS: ccs}
+	switch cfg.backend {
+	case backend.GROTH16:
+		keys.PK, keys.VK, err = groth16.Setup(ccs)
+	case backend.PLONK:
+		keys.PK, keys.VK, err = plonk.Setup(ccs, cfg.srs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Prove proves that assignment satisfies the circuit of keys.
+func Prove(keys *Keys, assignment frontend.Circuit) (Proof, error) {
+	witness, err := frontend.NewWitness(assignment, ecc.BN254)
+	if err != nil {
+		return nil, err
+	}
+
+	switch pk := keys.PK.(type) {
+	case groth16.ProvingKey:
+		return groth16.Prove(keys.CCS, pk, witness)
+	case plonk.ProvingKey:
+		return plonk.Prove(keys.CCS, pk, witness)
+	default:
+		return nil, ErrUnknownBackend
+	}
+}
+
+// PublicWitness extracts the public inputs of assignment.
+func PublicWitness(assignment frontend.Circuit) (*witness.Witness, error) {
+	return frontend.NewWitness(assignment, ecc.BN254, frontend.PublicOnly())
+}
+
+// Verify checks proof against the public inputs of publicWitness.
+func Verify(vk VerifyingKey, proof Proof, publicWitness *witness.Witness) error {
+	switch vk := vk.(type) {
+	case groth16.VerifyingKey:
+		p, ok := proof.(groth16.Proof)
+		if !ok {
+			return ErrBackend
+		}
+		return groth16.Verify(p, vk, publicWitness)
+	case plonk.VerifyingKey:
+		// a groth16 proof also implements plonk.Proof, so its concrete type is checked
+		if reflect.TypeOf(proof) != reflect.TypeOf(plonk.NewProof(ecc.BN254)) {
+			return ErrBackend
+		}
+		return plonk.Verify(proof, vk, publicWitness)
+	default:
+		return ErrUnknownBackend
+	}
+}
@@ -0,0 +1,99 @@
+package prover
+
+import (
+	"testing"
+
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+)
+
+type cubicCircuit struct {
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (circuit *cubicCircuit) Define(api frontend.API) error {
+	x3 := api.Mul(circuit.X, circuit.X, circuit.X)
+	api.AssertIsEqual(circuit.Y, api.Add(x3, circuit.X, 5))
+	return nil
+}
+
+func TestSetupProveVerify(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	ccs, err := Compile(&cubicCircuit{})
+	assert.NoError(err)
+	keys, err := Setup(ccs)
+	assert.NoError(err)
+
+	assignment := &cubicCircuit{X: 3, Y: 35}
+	proof, err := Prove(keys, assignment)
+	assert.NoError(err)
+
+	publicWitness, err := PublicWitness(assignment)
+	assert.NoError(err)
+	assert.NoError(Verify(keys.VK, proof, publicWitness))
+
+	// errors are returned instead of panicking
+	publicWitness, err = PublicWitness(&cubicCircuit{Y: 36})
+	assert.NoError(err)
+	assert.Error(Verify(keys.VK, proof, publicWitness))
+
+	_, err = Prove(keys, &cubicCircuit{X: 3, Y: 36})
+	assert.Error(err)
+}
+
+func TestPlonk(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	_, err := Setup(nil, WithBackend(backend.PLONK))
+	assert.ErrorIs(err, ErrNoSRS)
+
+	// a single SRS serves circuits of different sizes
+	ccsSum, err := Compile(newSumCircuit(8), WithBackend(backend.PLONK))
+	assert.NoError(err)
+	srs, err := NewUnsafeSRS(SRSSize(ccsSum))
+	assert.NoError(err)
+
+	for _, c := range []struct {
+		circuit, assignment frontend.Circuit
+	}{
+		{&cubicCircuit{}, &cubicCircuit{X: 3, Y: 35}},
+		{newSumCircuit(8), &sumCircuit{X: []frontend.Variable{1, 1, 1, 1, 1, 1, 1, 2}, Sum: 11}},
+	} {
+		ccs, err := Compile(c.circuit, WithBackend(backend.PLONK))
+		assert.NoError(err)
+		keys, err := Setup(ccs, WithBackend(backend.PLONK), WithSRS(srs))
+		assert.NoError(err)
+		assert.Equal(backend.PLONK, keys.Backend)
+
+		proof, err := Prove(keys, c.assignment)
+		assert.NoError(err)
+		publicWitness, err := PublicWitness(c.assignment)
+		assert.NoError(err)
+		assert.NoError(Verify(keys.VK, proof, publicWitness))
+	}
+
+	// a PLONK proof is not accepted by a groth16 verifying key
+	ccs, err := Compile(&cubicCircuit{}, WithBackend(backend.PLONK))
+	assert.NoError(err)
+	keys, err := Setup(ccs, WithBackend(backend.PLONK), WithSRS(srs))
+	assert.NoError(err)
+	assignment := &cubicCircuit{X: 3, Y: 35}
+	proof, err := Prove(keys, assignment)
+	assert.NoError(err)
+
+	ccs, err = Compile(&cubicCircuit{})
+	assert.NoError(err)
+	groth16Keys, err := Setup(ccs)
+	assert.NoError(err)
+	publicWitness, err := PublicWitness(assignment)
+	assert.NoError(err)
+	assert.Error(Verify(groth16Keys.VK, proof, publicWitness))
+
+	// nor a groth16 proof by a PLONK verifying key
+	groth16Proof, err := Prove(groth16Keys, assignment)
+	assert.NoError(err)
+	assert.ErrorIs(Verify(keys.VK, groth16Proof, publicWitness), ErrBackend)
+}
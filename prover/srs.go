@@ -0,0 +1,27 @@
+package prover
+
+import (
+	"crypto/rand"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/kzg"
+	"github.com/consensys/gnark/frontend"
+)
+
+// SRSSize returns the size of the smallest KZG SRS the PLONK keys of ccs can be set up with.
+func SRSSize(ccs frontend.CompiledConstraintSystem) uint64 {
+	_, _, public := ccs.GetNbVariables()
+	return ecc.NextPowerOfTwo(uint64(ccs.GetNbConstraints()+public)) + 3
+}
+
+// NewUnsafeSRS returns a KZG SRS of the given size. Its trapdoor is sampled by the
+// caller, who could forge proofs: it is only meant for tests and benchmarks, a
+// deployment reads the SRS of a powers-of-tau ceremony instead.
+func NewUnsafeSRS(size uint64) (*kzg.SRS, error) {
+	alpha, err := rand.Int(rand.Reader, fr.Modulus())
+	if err != nil {
+		return nil, err
+	}
+	return kzg.NewSRS(size, alpha)
+}
@@ -0,0 +1,91 @@
+package registry
+
+import (
+	"blockchain_DP/hashfunctions"
+	"blockchain_DP/merkle"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	tedwardsbn254 "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra/twistededwards"
+	eddsa "github.com/consensys/gnark/std/signature/eddsa"
+)
+
+// censusTag is "census" in ASCII. It separates the leaves of the registry of census
+// keys from the other leaves hashed from field elements.
+const censusTag uint64 = 0x63656e737573
+
+// CensusLeaf computes the leaf H(tag||S.X||S.Y||E.X||E.Y) registering a census by its
+// signing key S and its ElGamal key E in the published registry of census keys. The
+// registry is a plain Merkle tree of these leaves, one per census, so that both keys
+// opened from a leaf are those of the same census.
+func CensusLeaf(h hashfunctions.HashID, sigKey, encKey tedwardsbn254.PointAffine) (res fr.Element) {
+	tag := fr.NewElement(censusTag)
+
+	hfunc := h.New()
+	for _, e := range []*fr.Element{&tag, &sigKey.X, &sigKey.Y, &encKey.X, &encKey.Y} {
+		hfunc.Write(e.Marshal())
+	}
+	res.SetBytes(hfunc.Sum(nil))
+	return res
+}
+
+// CensusBinding computes H(leaf||secret), which commits to the census of the given leaf
+// with a secret shared by several proofs, so that they can be checked to use the same
+// census without revealing which one.
+func CensusBinding(h hashfunctions.HashID, leaf, secret fr.Element) (res fr.Element) {
+	hfunc := h.New()
+	hfunc.Write(leaf.Marshal())
+	hfunc.Write(secret.Marshal())
+	res.SetBytes(hfunc.Sum(nil))
+	return res
+}
+
+// HiddenCensus is a private census of the registry of census keys of public root Root:
+// the circuit proves that its keys are registered together without revealing which
+// census it is. Binding is the CensusBinding of its leaf.
+type HiddenCensus struct {
+	SigKey  eddsa.PublicKey
+	EncKey  eddsa.PublicKey
+	Path    merkle.CircuitPath
+	Root    frontend.Variable `gnark:",public"`
+	Binding frontend.Variable `gnark:",public"`
+}
+
+// NewHiddenCensus returns a census of a registry of the given depth, to be compiled.
+func NewHiddenCensus(depth int) HiddenCensus {
+	return HiddenCensus{Path: merkle.NewCircuitPath(depth)}
+}
+
+// AssignHiddenCensus returns the assignment of the census of keys sigKey and encKey,
+// registered at path in the registry of the given root, of CensusBinding binding.
+func AssignHiddenCensus(sigKey, encKey tedwardsbn254.PointAffine, path merkle.Path, root, binding fr.Element) HiddenCensus {
+	return HiddenCensus{
+		SigKey:  eddsa.PublicKey{A: twistededwards.Point{X: sigKey.X, Y: sigKey.Y}},
+		EncKey:  eddsa.PublicKey{A: twistededwards.Point{X: encKey.X, Y: encKey.Y}},
+		Path:    path.Assign(),
+		Root:    root,
+		Binding: binding,
+	}
+}
+
+// AssertRegistered checks that the CensusLeaf of the keys is in the registry of root
+// Root, and that Binding is its CensusBinding with secret.
+func (c *HiddenCensus) AssertRegistered(api frontend.API, h hashfunctions.HashID, secret frontend.Variable) error {
+
+	hfunc, err := h.NewGadget(api)
+	if err != nil {
+		return err
+	}
+	hfunc.Write(censusTag, c.SigKey.A.X, c.SigKey.A.Y, c.EncKey.A.X, c.EncKey.A.Y)
+	leaf := hfunc.Sum()
+
+	if err = c.Path.AssertMembership(api, h, c.Root, leaf); err != nil {
+		return err
+	}
+
+	hfunc.Reset()
+	hfunc.Write(leaf, secret)
+	api.AssertIsEqual(c.Binding, hfunc.Sum())
+	return nil
+}
@@ -0,0 +1,95 @@
+// Package registry implements the registry published by the registration authority:
+// a Merkle tree whose leaves H(a_pk||ID) register each address to an ID.
+//
+// Unlike a signature over all the addresses of an ID, the registry is extended
+// without re-signing anything, and membership is proven with a path of fixed size.
+//
+// The package also implements the registry of census keys, whose leaves
+// H(tag||S.X||S.Y||E.X||E.Y) register the signing and ElGamal keys of each census, so
+// that a circuit hides which of the registered census it uses.
+package registry
+
+import (
+	"blockchain_DP/hashfunctions"
+	"blockchain_DP/merkle"
+	"errors"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/frontend"
+)
+
+var (
+	ErrRegistered    = errors.New("address already registered")
+	ErrNotRegistered = errors.New("address not registered")
+)
+
+// Registry is the registry of the registration authority. An address is registered
+// to a single ID.
+type Registry struct {
+	hashID hashfunctions.HashID
+	tree   *merkle.Tree
+	index  map[fr.Element]uint64
+}
+
+// New creates an empty registry of the given depth, holding up to 2^depth addresses.
+func New(h hashfunctions.HashID, depth int) (*Registry, error) {
+	tree, err := merkle.New(h, depth)
+	if err != nil {
+		return nil, err
+	}
+	return &Registry{hashID: h, tree: tree, index: make(map[fr.Element]uint64)}, nil
+}
+
+// Leaf computes the leaf H(a_pk||ID) registering apk to id.
+func Leaf(h hashfunctions.HashID, apk fr.Element, id *big.Int) (res fr.Element) {
+	var e fr.Element
+	e.SetBigInt(id)
+
+	hfunc := h.New()
+	hfunc.Write(apk.Marshal())
+	hfunc.Write(e.Marshal())
+	res.SetBytes(hfunc.Sum(nil))
+	return res
+}
+
+// Register registers apk to id.
+func (r *Registry) Register(apk fr.Element, id *big.Int) error {
+	if _, ok := r.index[apk]; ok {
+		return ErrRegistered
+	}
+
+	index, err := r.tree.Append(Leaf(r.hashID, apk, id))
+	if err != nil {
+		return err
+	}
+	r.index[apk] = index
+	return nil
+}
+
+// Path returns the authentication path of the leaf of apk.
+func (r *Registry) Path(apk fr.Element) (merkle.Path, error) {
+	index, ok := r.index[apk]
+	if !ok {
+		return merkle.Path{}, ErrNotRegistered
+	}
+	return r.tree.Path(index)
+}
+
+// Root returns the root of the registry, published by the registration authority.
+func (r *Registry) Root() fr.Element {
+	return r.tree.Root()
+}
+
+// AssertRegistered is the gadget checking that apk is registered to id in the
+// registry of the given root.
+func AssertRegistered(api frontend.API, h hashfunctions.HashID, root, apk, id frontend.Variable, path *merkle.CircuitPath) error {
+
+	hfunc, err := h.NewGadget(api)
+	if err != nil {
+		return err
+	}
+	hfunc.Write(apk, id)
+
+	return path.AssertMembership(api, h, root, hfunc.Sum())
+}
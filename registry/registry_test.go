@@ -0,0 +1,78 @@
+package registry
+
+import (
+	"blockchain_DP/hashfunctions"
+	"blockchain_DP/merkle"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+)
+
+type registeredCircuit struct {
+	hashID hashfunctions.HashID
+	Root   frontend.Variable `gnark:",public"`
+	Apk    frontend.Variable
+	ID     frontend.Variable
+	Path   merkle.CircuitPath
+}
+
+func (circuit *registeredCircuit) Define(api frontend.API) error {
+	return AssertRegistered(api, circuit.hashID, circuit.Root, circuit.Apk, circuit.ID, &circuit.Path)
+}
+
+func TestRegistry(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	const depth = 8
+	for _, hashID := range []hashfunctions.HashID{hashfunctions.MiMC, hashfunctions.Poseidon} {
+		reg, err := New(hashID, depth)
+		assert.NoError(err)
+
+		// two addresses of ID 7 and one of ID 300
+		apks := make([]fr.Element, 3)
+		ids := []*big.Int{big.NewInt(7), big.NewInt(7), big.NewInt(300)}
+		for i := range apks {
+			_, err = apks[i].SetRandom()
+			assert.NoError(err)
+			assert.NoError(reg.Register(apks[i], ids[i]))
+		}
+		assert.ErrorIs(reg.Register(apks[0], ids[2]), ErrRegistered)
+
+		var unknown fr.Element
+		_, err = unknown.SetRandom()
+		assert.NoError(err)
+		_, err = reg.Path(unknown)
+		assert.ErrorIs(err, ErrNotRegistered)
+
+		path, err := reg.Path(apks[1])
+		assert.NoError(err)
+		assert.True(path.Verify(hashID, reg.Root(), Leaf(hashID, apks[1], ids[1])))
+
+		var circuit, assignment registeredCircuit
+		circuit.hashID = hashID
+		circuit.Path = merkle.NewCircuitPath(depth)
+		assignment.Root = reg.Root()
+		assignment.Apk = apks[1]
+		assignment.ID = ids[1]
+		assignment.Path = path.Assign()
+
+		err = test.IsSolved(&circuit, &assignment, ecc.BN254, backend.GROTH16)
+		assert.NoError(err, hashID.String())
+
+		// the address is not registered to another ID
+		assignment.ID = ids[2]
+		err = test.IsSolved(&circuit, &assignment, ecc.BN254, backend.GROTH16)
+		assert.Error(err, hashID.String())
+
+		// nor is another address
+		assignment.ID = ids[1]
+		assignment.Apk = unknown
+		err = test.IsSolved(&circuit, &assignment, ecc.BN254, backend.GROTH16)
+		assert.Error(err, hashID.String())
+	}
+}
@@ -0,0 +1,163 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Log is an append-only log of checksummed records, type||len||payload||crc32. Every
+// record is synced before Append returns; a last record cut short by a crash is
+// dropped when the log is opened, but any other invalid record fails with ErrCorrupted.
+// It is not safe for concurrent use.
+type Log struct {
+	path string
+	f    *os.File
+}
+
+// OpenLog opens (or creates) the log at path and replays its records with apply.
+func OpenLog(path string, apply func(t byte, payload []byte) error) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{path: path, f: f}
+	if err = l.replay(apply); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Close closes the log.
+func (l *Log) Close() error {
+	return l.f.Close()
+}
+
+// Append appends a record to the log and syncs it. A record which failed is truncated,
+// so that the next one follows the last complete record.
+func (l *Log) Append(t byte, payload []byte) error {
+	offset, err := l.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = l.f.Write(encodeRecord(t, payload)); err == nil {
+		err = l.f.Sync()
+	}
+	if err != nil {
+		if errTrunc := l.f.Truncate(offset); errTrunc != nil {
+			return fmt.Errorf("%w (truncating the log: %v)", err, errTrunc)
+		}
+		if _, errSeek := l.f.Seek(offset, io.SeekStart); errSeek != nil {
+			return fmt.Errorf("%w (truncating the log: %v)", err, errSeek)
+		}
+		return err
+	}
+	return nil
+}
+
+// replay reads the log. A last record cut short by a crash is truncated, but any other
+// invalid record fails with ErrCorrupted, so that no later record is lost.
+func (l *Log) replay(apply func(t byte, payload []byte) error) error {
+	r := bufio.NewReader(l.f)
+
+	var offset int64
+	for {
+		t, payload, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err == io.ErrUnexpectedEOF {
+			// drop a record interrupted by a crash
+			if err = l.f.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w at offset %d", err, offset)
+		}
+		if err = apply(t, payload); err != nil {
+			return err
+		}
+		offset += int64(headerSize + len(payload) + checksumSize)
+	}
+
+	_, err := l.f.Seek(offset, io.SeekStart)
+	return err
+}
+
+// encodeRecord returns type||len||payload||crc32.
+func encodeRecord(t byte, payload []byte) []byte {
+	record := make([]byte, headerSize, headerSize+len(payload)+checksumSize)
+	record[0] = t
+	binary.BigEndian.PutUint32(record[1:], uint32(len(payload)))
+	record = append(record, payload...)
+	return appendUint32(record, crc32.ChecksumIEEE(record))
+}
+
+func readRecord(r io.Reader) (byte, []byte, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > maxRecordSize {
+		return 0, nil, ErrCorrupted
+	}
+	body := make([]byte, length+checksumSize)
+	if _, err := io.ReadFull(r, body); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+
+	payload := body[:len(body)-checksumSize]
+	crc := crc32.NewIEEE()
+	crc.Write(header[:])
+	crc.Write(payload)
+	if crc.Sum32() != binary.BigEndian.Uint32(body[len(payload):]) {
+		return 0, nil, ErrCorrupted
+	}
+
+	return header[0], payload, nil
+}
+
+// writeFile atomically replaces the file at path with buf.
+func writeFile(path string, buf []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(buf); err == nil {
+		err = f.Sync()
+	}
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
@@ -0,0 +1,306 @@
+package store
+
+import (
+	"blockchain_DP/hashfunctions"
+	"blockchain_DP/merkle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+)
+
+const (
+	logFile      = "records.log"
+	snapshotFile = "frontier.snapshot"
+
+	// number of commitments between two snapshots of the frontier
+	snapshotInterval = 1024
+
+	recordCommitment byte = 1
+	recordNullifiers byte = 2
+
+	headerSize   = 1 + 4
+	checksumSize = 4
+	elementSize  = fr.Bytes
+
+	maxRecordSize = 1 << 20
+)
+
+var (
+	ErrDoubleSpend   = errors.New("serial number already spent")
+	ErrCorrupted     = errors.New("corrupted store")
+	ErrDepthMismatch = errors.New("store was created with another tree depth")
+)
+
+// Store persists the frontier of the note commitment tree, its historic roots and the
+// spent serial numbers. Every update is appended to a log of checksummed records and
+// synced before returning; a record cut short by a crash is dropped when reopening.
+// The log is never compacted: it is read in full when reopening, but the frontier is
+// periodically snapshotted so that only the commitments appended since are hashed again.
+// It is safe for concurrent use.
+type Store struct {
+	mu sync.Mutex
+
+	dir    string
+	hashID hashfunctions.HashID
+	log    *Log
+
+	frontier *merkle.Frontier
+	roots    map[fr.Element]struct{}
+	spent    map[fr.Element]struct{}
+
+	// first periodic snapshot that failed
+	snapshotErr error
+}
+
+// Open opens (or creates) the store in dir, for a note commitment tree of the given depth.
+func Open(dir string, h hashfunctions.HashID, depth int) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		dir:    dir,
+		hashID: h,
+		roots:  make(map[fr.Element]struct{}),
+		spent:  make(map[fr.Element]struct{}),
+	}
+
+	var err error
+	s.frontier, err = s.readSnapshot(depth)
+	if err != nil {
+		return nil, err
+	}
+	s.roots[s.frontier.Root()] = struct{}{}
+
+	if s.log, err = OpenLog(filepath.Join(dir, logFile), s.apply); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Close writes a snapshot of the frontier and closes the store. It also reports the
+// first periodic snapshot that failed since the store was opened.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.writeSnapshot()
+	if err == nil && s.snapshotErr != nil {
+		err = fmt.Errorf("writing a periodic snapshot: %w", s.snapshotErr)
+	}
+	if errClose := s.log.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
+
+// SnapshotErr returns the first periodic snapshot that failed since the store was
+// opened, if any. The commitments are still in the log.
+func (s *Store) SnapshotErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshotErr
+}
+
+// Root returns the current root of the note commitment tree.
+func (s *Store) Root() fr.Element {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.frontier.Root()
+}
+
+// Size returns the number of note commitments in the tree.
+func (s *Store) Size() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.frontier.Size()
+}
+
+// IsKnownRoot reports whether root is the current root or a previous root of the tree.
+func (s *Store) IsKnownRoot(root fr.Element) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.roots[root]
+	return ok
+}
+
+// IsSpent reports whether the serial number sn was already spent.
+func (s *Store) IsSpent(sn fr.Element) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.spent[sn]
+	return ok
+}
+
+// AppendCommitment adds a note commitment to the tree and returns its index and the new root.
+func (s *Store) AppendCommitment(cm fr.Element) (uint64, fr.Element, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	backup, err := merkle.RestoreFrontier(s.hashID, s.frontier.Size(), s.frontier.Nodes(), s.frontier.Root())
+	if err != nil {
+		return 0, fr.Element{}, err
+	}
+
+	index, err := s.frontier.Append(cm)
+	if err != nil {
+		return 0, fr.Element{}, err
+	}
+	root := s.frontier.Root()
+
+	payload := make([]byte, 8, 8+2*elementSize)
+	binary.BigEndian.PutUint64(payload, index)
+	cmB, rootB := cm.Bytes(), root.Bytes()
+	payload = append(payload, cmB[:]...)
+	payload = append(payload, rootB[:]...)
+
+	if err = s.log.Append(recordCommitment, payload); err != nil {
+		s.frontier = backup
+		return 0, fr.Element{}, err
+	}
+	s.roots[root] = struct{}{}
+
+	// the commitment is in the log: a failed snapshot is retried at the next interval
+	// and on Close, which reports it
+	if s.frontier.Size()%snapshotInterval == 0 {
+		if err = s.writeSnapshot(); err != nil && s.snapshotErr == nil {
+			s.snapshotErr = err
+		}
+	}
+
+	return index, root, nil
+}
+
+// MarkSpent records the serial numbers of a transaction as spent. Either all of them are
+// recorded or, if one was already spent (or appears twice), none is and ErrDoubleSpend is returned.
+func (s *Store) MarkSpent(sns ...fr.Element) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[fr.Element]struct{}, len(sns))
+	payload := make([]byte, 0, len(sns)*elementSize)
+	for i := range sns {
+		if _, ok := s.spent[sns[i]]; ok {
+			return fmt.Errorf("%w: %s", ErrDoubleSpend, sns[i].String())
+		}
+		if _, ok := seen[sns[i]]; ok {
+			return fmt.Errorf("%w: %s appears twice", ErrDoubleSpend, sns[i].String())
+		}
+		seen[sns[i]] = struct{}{}
+		b := sns[i].Bytes()
+		payload = append(payload, b[:]...)
+	}
+
+	if err := s.log.Append(recordNullifiers, payload); err != nil {
+		return err
+	}
+	for sn := range seen {
+		s.spent[sn] = struct{}{}
+	}
+
+	return nil
+}
+
+func (s *Store) apply(t byte, payload []byte) error {
+	switch t {
+	case recordCommitment:
+		if len(payload) != 8+2*elementSize {
+			return ErrCorrupted
+		}
+		index := binary.BigEndian.Uint64(payload)
+		var cm, root fr.Element
+		cm.SetBytes(payload[8 : 8+elementSize])
+		root.SetBytes(payload[8+elementSize:])
+		s.roots[root] = struct{}{}
+
+		// commitments already in the snapshot are skipped
+		if index < s.frontier.Size() {
+			return nil
+		}
+		if index != s.frontier.Size() {
+			return fmt.Errorf("%w: missing commitment %d", ErrCorrupted, s.frontier.Size())
+		}
+		if _, err := s.frontier.Append(cm); err != nil {
+			return err
+		}
+		if current := s.frontier.Root(); !current.Equal(&root) {
+			return fmt.Errorf("%w: root mismatch at commitment %d", ErrCorrupted, index)
+		}
+
+	case recordNullifiers:
+		if len(payload)%elementSize != 0 {
+			return ErrCorrupted
+		}
+		for i := 0; i < len(payload); i += elementSize {
+			var sn fr.Element
+			sn.SetBytes(payload[i : i+elementSize])
+			s.spent[sn] = struct{}{}
+		}
+
+	default:
+		return fmt.Errorf("%w: unknown record type %d", ErrCorrupted, t)
+	}
+
+	return nil
+}
+
+// writeSnapshot atomically replaces the snapshot with the current frontier:
+// depth||size||root||filled nodes||crc32.
+func (s *Store) writeSnapshot() error {
+	buf := make([]byte, 4+8)
+	binary.BigEndian.PutUint32(buf, uint32(s.frontier.Depth()))
+	binary.BigEndian.PutUint64(buf[4:], s.frontier.Size())
+	root := s.frontier.Root()
+	rootB := root.Bytes()
+	buf = append(buf, rootB[:]...)
+	for _, node := range s.frontier.Nodes() {
+		b := node.Bytes()
+		buf = append(buf, b[:]...)
+	}
+	buf = appendUint32(buf, crc32.ChecksumIEEE(buf))
+
+	return writeFile(filepath.Join(s.dir, snapshotFile), buf)
+}
+
+// readSnapshot loads the frontier from the snapshot, or returns an empty one.
+func (s *Store) readSnapshot(depth int) (*merkle.Frontier, error) {
+	buf, err := os.ReadFile(filepath.Join(s.dir, snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return merkle.NewFrontier(s.hashID, depth)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buf) != 4+8+(depth+1)*elementSize+checksumSize {
+		if len(buf) >= 4 && int(binary.BigEndian.Uint32(buf)) != depth {
+			return nil, ErrDepthMismatch
+		}
+		return nil, ErrCorrupted
+	}
+	data := buf[:len(buf)-checksumSize]
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(buf[len(data):]) {
+		return nil, ErrCorrupted
+	}
+	if int(binary.BigEndian.Uint32(data)) != depth {
+		return nil, ErrDepthMismatch
+	}
+
+	size := binary.BigEndian.Uint64(data[4:])
+	var root fr.Element
+	root.SetBytes(data[12 : 12+elementSize])
+	filled := make([]fr.Element, depth)
+	for i := range filled {
+		offset := 12 + (i+1)*elementSize
+		filled[i].SetBytes(data[offset : offset+elementSize])
+	}
+
+	return merkle.RestoreFrontier(s.hashID, size, filled, root)
+}
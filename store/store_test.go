@@ -0,0 +1,188 @@
+package store
+
+import (
+	"blockchain_DP/hashfunctions"
+	"blockchain_DP/merkle"
+	"os"
+	"path/filepath"
+	"testing"
+
+	fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/test"
+)
+
+const depth = 16
+
+func randomElements(assert *test.Assert, n int) []fr.Element {
+	res := make([]fr.Element, n)
+	for i := range res {
+		_, err := res[i].SetRandom()
+		assert.NoError(err)
+	}
+	return res
+}
+
+func TestStorePersistence(t *testing.T) {
+	assert := test.NewAssert(t)
+	dir := t.TempDir()
+
+	s, err := Open(dir, hashfunctions.MiMC, depth)
+	assert.NoError(err)
+
+	tree, err := merkle.New(hashfunctions.MiMC, depth)
+	assert.NoError(err)
+
+	var roots []fr.Element
+	for i, cm := range randomElements(assert, 10) {
+		index, root, err := s.AppendCommitment(cm)
+		assert.NoError(err)
+		assert.Equal(uint64(i), index)
+
+		_, err = tree.Append(cm)
+		assert.NoError(err)
+		expected := tree.Root()
+		assert.True(root.Equal(&expected))
+		roots = append(roots, root)
+	}
+
+	sns := randomElements(assert, 3)
+	assert.NoError(s.MarkSpent(sns[0], sns[1]))
+	assert.ErrorIs(s.MarkSpent(sns[1], sns[2]), ErrDoubleSpend)
+	assert.ErrorIs(s.MarkSpent(sns[2], sns[2]), ErrDoubleSpend)
+	assert.False(s.IsSpent(sns[2]), "a rejected batch must not be recorded")
+
+	// reopen without a snapshot, from the log only
+	assert.NoError(s.log.Close())
+	s, err = Open(dir, hashfunctions.MiMC, depth)
+	assert.NoError(err)
+	assert.Equal(uint64(10), s.Size())
+	for _, root := range roots {
+		assert.True(s.IsKnownRoot(root))
+	}
+	assert.True(s.IsSpent(sns[0]) && s.IsSpent(sns[1]))
+	assert.False(s.IsSpent(sns[2]))
+	assert.ErrorIs(s.MarkSpent(sns[0]), ErrDoubleSpend)
+
+	// reopen from the snapshot and the records written after it
+	assert.NoError(s.Close())
+	s, err = Open(dir, hashfunctions.MiMC, depth)
+	assert.NoError(err)
+	cm := randomElements(assert, 1)[0]
+	_, root, err := s.AppendCommitment(cm)
+	assert.NoError(err)
+	assert.NoError(s.MarkSpent(sns[2]))
+	assert.NoError(s.log.Close())
+
+	s, err = Open(dir, hashfunctions.MiMC, depth)
+	assert.NoError(err)
+	current := s.Root()
+	assert.True(current.Equal(&root))
+	assert.True(s.IsKnownRoot(roots[0]))
+	assert.True(s.IsSpent(sns[2]))
+	assert.NoError(s.Close())
+
+	_, err = Open(dir, hashfunctions.MiMC, depth+1)
+	assert.ErrorIs(err, ErrDepthMismatch)
+}
+
+func TestStoreInterruptedAppend(t *testing.T) {
+	assert := test.NewAssert(t)
+	dir := t.TempDir()
+
+	s, err := Open(dir, hashfunctions.MiMC, depth)
+	assert.NoError(err)
+	_, root, err := s.AppendCommitment(randomElements(assert, 1)[0])
+	assert.NoError(err)
+	sn := randomElements(assert, 1)[0]
+	assert.NoError(s.MarkSpent(sn))
+	assert.NoError(s.log.Close())
+
+	// simulate a crash in the middle of writing a record
+	path := filepath.Join(dir, logFile)
+	info, err := os.Stat(path)
+	assert.NoError(err)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	assert.NoError(err)
+	_, err = f.Write([]byte{recordCommitment, 0, 0, 0, 72, 1, 2, 3})
+	assert.NoError(err)
+	assert.NoError(f.Close())
+
+	s, err = Open(dir, hashfunctions.MiMC, depth)
+	assert.NoError(err)
+	current := s.Root()
+	assert.True(current.Equal(&root))
+	assert.True(s.IsSpent(sn))
+
+	// the partial record was dropped and new records are readable
+	info2, err := os.Stat(path)
+	assert.NoError(err)
+	assert.Equal(info.Size(), info2.Size())
+
+	_, root, err = s.AppendCommitment(randomElements(assert, 1)[0])
+	assert.NoError(err)
+	assert.NoError(s.Close())
+
+	s, err = Open(dir, hashfunctions.MiMC, depth)
+	assert.NoError(err)
+	current = s.Root()
+	assert.True(current.Equal(&root))
+	assert.NoError(s.Close())
+}
+
+func TestStoreCorruptedRecord(t *testing.T) {
+	assert := test.NewAssert(t)
+	dir := t.TempDir()
+
+	s, err := Open(dir, hashfunctions.MiMC, depth)
+	assert.NoError(err)
+	_, _, err = s.AppendCommitment(randomElements(assert, 1)[0])
+	assert.NoError(err)
+	assert.NoError(s.MarkSpent(randomElements(assert, 1)[0]))
+	assert.NoError(s.log.Close())
+
+	// flip a bit of the first record, followed by a valid one
+	path := filepath.Join(dir, logFile)
+	buf, err := os.ReadFile(path)
+	assert.NoError(err)
+	buf[headerSize] ^= 1
+	assert.NoError(os.WriteFile(path, buf, 0o644))
+
+	_, err = Open(dir, hashfunctions.MiMC, depth)
+	assert.ErrorIs(err, ErrCorrupted)
+
+	// the records after the corrupted one are kept
+	info, err := os.Stat(path)
+	assert.NoError(err)
+	assert.Equal(int64(len(buf)), info.Size())
+}
+
+func TestStoreFailedSnapshot(t *testing.T) {
+	assert := test.NewAssert(t)
+	dir := t.TempDir()
+
+	s, err := Open(dir, hashfunctions.MiMC, depth)
+	assert.NoError(err)
+
+	// the temporary snapshot can not be created
+	tmp := filepath.Join(dir, snapshotFile+".tmp")
+	assert.NoError(os.Mkdir(tmp, 0o755))
+
+	var root fr.Element
+	for _, cm := range randomElements(assert, snapshotInterval) {
+		_, root, err = s.AppendCommitment(cm)
+		assert.NoError(err, "the commitment is appended even if the snapshot fails")
+	}
+	_, err = os.Stat(filepath.Join(dir, snapshotFile))
+	assert.True(os.IsNotExist(err))
+	assert.Error(s.SnapshotErr())
+
+	// Close writes the snapshot but reports the failure
+	assert.NoError(os.Remove(tmp))
+	assert.Error(s.Close())
+	s, err = Open(dir, hashfunctions.MiMC, depth)
+	assert.NoError(err)
+	current := s.Root()
+	assert.True(current.Equal(&root))
+	assert.Equal(uint64(snapshotInterval), s.Size())
+	assert.NoError(s.Close())
+}
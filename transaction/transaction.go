@@ -0,0 +1,192 @@
+// Package transaction binds the xi and delta proofs of a payment together.
+//
+// The delta proof takes the commitment CMXi and the nu_2 of the xi proof as public
+// inputs, so it can not be replayed with the xi proof of another transaction: a
+// different xi, or other notes spent (hence other serial numbers), change CMXi or nu_2.
+//
+// The census signature of the xi proof is only valid for its epoch, a public input of
+// the xi proof, which the verifier checks against its clock.
+//
+// A census hidden in the registry of census keys is bound to xi in both proofs: the
+// proofs must have the same root of the registry and the same binding, so that the
+// report is encrypted to the census which signed xi_R. Public census keys are checked
+// by the verifier against those of the census.
+//
+// The two proofs do not bind the ID reported to the owners of the notes spent: the
+// combined circuit of package txcircuit does.
+package transaction
+
+import (
+	"blockchain_DP/census"
+	"blockchain_DP/deltacircuit"
+	"blockchain_DP/prover"
+	"blockchain_DP/xicircuit"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/schema"
+)
+
+var (
+	ErrCMXiMismatch   = errors.New("xi and delta proofs are for different commitments to xi")
+	ErrNuMismatch     = errors.New("delta proof is bound to another nu_2")
+	ErrCensusMismatch = errors.New("xi and delta proofs are for different census")
+	ErrNoClock        = errors.New("verifier without a clock or a validity for census signatures")
+)
+
+// Transaction carries the xi and delta proofs of a payment and their public inputs.
+type Transaction struct {
+	XiProof     prover.Proof
+	XiPublic    *witness.Witness
+	DeltaProof  prover.Proof
+	DeltaPublic *witness.Witness
+}
+
+// New proves the xi and delta assignments of a payment.
+func New(xiKeys, deltaKeys *prover.Keys, xi *xicircuit.XiCircuit, delta *deltacircuit.DeltaCircuit) (*Transaction, error) {
+	var tx Transaction
+	var err error
+
+	if tx.XiPublic, err = prover.PublicWitness(xi); err != nil {
+		return nil, err
+	}
+	if tx.DeltaPublic, err = prover.PublicWitness(delta); err != nil {
+		return nil, err
+	}
+	if err = checkBinding(tx.XiPublic, tx.DeltaPublic); err != nil {
+		return nil, err
+	}
+
+	if tx.XiProof, err = prover.Prove(xiKeys, xi); err != nil {
+		return nil, fmt.Errorf("xi proof: %w", err)
+	}
+	if tx.DeltaProof, err = prover.Prove(deltaKeys, delta); err != nil {
+		return nil, fmt.Errorf("delta proof: %w", err)
+	}
+
+	return &tx, nil
+}
+
+// Verifier checks transactions against the verifying keys of the xi and delta circuits.
+type Verifier struct {
+	xiVK, deltaVK         prover.VerifyingKey
+	xiSchema, deltaSchema *schema.Schema
+	clock                 census.Clock
+	validity              uint64
+}
+
+// NewVerifier returns a verifier of transactions whose proofs are for the given
+// circuits (as returned by NewXiCircuit and NewDeltaCircuit). Transactions whose census
+// signature is not valid in the current epoch given by clock are rejected, signatures
+// being valid for the given number of epochs.
+func NewVerifier(xiVK, deltaVK prover.VerifyingKey, xi *xicircuit.XiCircuit, delta *deltacircuit.DeltaCircuit, clock census.Clock, validity uint64) (*Verifier, error) {
+	if clock == nil || validity == 0 {
+		return nil, ErrNoClock
+	}
+	v := &Verifier{xiVK: xiVK, deltaVK: deltaVK, clock: clock, validity: validity}
+
+	var err error
+	if v.xiSchema, err = schema.Parse(xi, tVariable, nil); err != nil {
+		return nil, err
+	}
+	if v.deltaSchema, err = schema.Parse(delta, tVariable, nil); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Verify checks that both proofs are valid and bound to each other. The public
+// witnesses may have been deserialized, without their schema.
+func (v *Verifier) Verify(tx *Transaction) error {
+	xiPublic, deltaPublic := *tx.XiPublic, *tx.DeltaPublic
+	xiPublic.Schema, deltaPublic.Schema = v.xiSchema, v.deltaSchema
+
+	if err := checkBinding(&xiPublic, &deltaPublic); err != nil {
+		return err
+	}
+	if err := checkEpoch(&xiPublic, v.clock(), v.validity); err != nil {
+		return err
+	}
+
+	if err := prover.Verify(v.xiVK, tx.XiProof, &xiPublic); err != nil {
+		return fmt.Errorf("xi proof: %w", err)
+	}
+	if err := prover.Verify(v.deltaVK, tx.DeltaProof, &deltaPublic); err != nil {
+		return fmt.Errorf("delta proof: %w", err)
+	}
+	return nil
+}
+
+var tVariable = reflect.ValueOf(struct{ A frontend.Variable }{}).FieldByName("A").Type()
+
+// hiddenCensus holds the public inputs of a census hidden in the registry of census
+// keys.
+type hiddenCensus struct {
+	Root, Binding fr.Element
+}
+
+// checkBinding checks that the delta proof is for the xi, the nu_2 and the hidden census
+// of the xi proof.
+func checkBinding(xiPublic, deltaPublic *witness.Witness) error {
+	var xi struct {
+		CMXi, Nu2      fr.Element
+		CensusRegistry []hiddenCensus
+	}
+	if err := decode(xiPublic, &xi); err != nil {
+		return fmt.Errorf("xi public witness: %w", err)
+	}
+	var delta struct {
+		CMXi, Nu fr.Element
+		Report   struct {
+			CensusRegistry []hiddenCensus
+		}
+	}
+	if err := decode(deltaPublic, &delta); err != nil {
+		return fmt.Errorf("delta public witness: %w", err)
+	}
+
+	if !xi.CMXi.Equal(&delta.CMXi) {
+		return ErrCMXiMismatch
+	}
+	if !xi.Nu2.Equal(&delta.Nu) {
+		return ErrNuMismatch
+	}
+	if len(xi.CensusRegistry) != len(delta.Report.CensusRegistry) {
+		return ErrCensusMismatch
+	}
+	for i := range xi.CensusRegistry {
+		if xi.CensusRegistry[i] != delta.Report.CensusRegistry[i] {
+			return ErrCensusMismatch
+		}
+	}
+	return nil
+}
+
+// checkEpoch checks that the census signature of the xi proof is valid in the current
+// epoch.
+func checkEpoch(xiPublic *witness.Witness, current, validity uint64) error {
+	var xi struct {
+		Epoch fr.Element
+	}
+	if err := decode(xiPublic, &xi); err != nil {
+		return fmt.Errorf("xi public witness: %w", err)
+	}
+	if !xi.Epoch.IsUint64() {
+		return census.ErrFutureEpoch
+	}
+	return census.CheckEpoch(xi.Epoch.Uint64(), current, validity)
+}
+
+// decode reads the public inputs of w into the fields of the same name of v.
+func decode(w *witness.Witness, v interface{}) error {
+	data, err := w.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
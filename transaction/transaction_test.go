@@ -0,0 +1,267 @@
+package transaction
+
+import (
+	"blockchain_DP/census"
+	"blockchain_DP/deltacircuit"
+	"blockchain_DP/elgamal"
+	"blockchain_DP/hashfunctions"
+	"blockchain_DP/merkle"
+	"blockchain_DP/note"
+	"blockchain_DP/prover"
+	"blockchain_DP/registry"
+	"blockchain_DP/xicircuit"
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+)
+
+const (
+	hashID    = hashfunctions.MiMC
+	treeDepth = 4
+	numInputs = 1
+	numApks   = 1
+	epoch     = 5
+
+	// depth of the registry of census keys
+	censusDepth = 4
+)
+
+func TestTransaction(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	xiCircuit := xicircuit.NewXiCircuit(numInputs, xicircuit.WithHash(hashID), xicircuit.WithTreeDepth(treeDepth))
+	deltaCircuit := deltacircuit.NewDeltaCircuit(numApks, deltacircuit.WithHash(hashID))
+	xiKeys := setUpKeys(t, xiCircuit)
+	deltaKeys := setUpKeys(t, deltaCircuit)
+
+	clock := func() uint64 { return epoch }
+	verifier, err := NewVerifier(xiKeys.VK, deltaKeys.VK, xiCircuit, deltaCircuit, clock, 1)
+	assert.NoError(err)
+
+	// the epoch of the census signature is always checked
+	_, err = NewVerifier(xiKeys.VK, deltaKeys.VK, xiCircuit, deltaCircuit, nil, 1)
+	assert.ErrorIs(err, ErrNoClock)
+	_, err = NewVerifier(xiKeys.VK, deltaKeys.VK, xiCircuit, deltaCircuit, clock, 0)
+	assert.ErrorIs(err, ErrNoClock)
+
+	xiW, deltaW := setUpWitnesses(t)
+	xi, delta := assign(t, xiW, deltaW)
+	tx, err := New(xiKeys, deltaKeys, xi, delta)
+	assert.NoError(err)
+	assert.NoError(verifier.Verify(tx))
+
+	// the public witnesses are sent without their schema
+	sent := *tx
+	sent.XiPublic, sent.DeltaPublic = roundTrip(t, tx.XiPublic), roundTrip(t, tx.DeltaPublic)
+	assert.NoError(verifier.Verify(&sent))
+
+	// the census signature is only valid in its epoch
+	for current, expected := range map[uint64]error{epoch: nil, epoch + 1: census.ErrExpired, epoch - 1: census.ErrFutureEpoch} {
+		current := current
+		v, err := NewVerifier(xiKeys.VK, deltaKeys.VK, xiCircuit, deltaCircuit, func() uint64 { return current }, 1)
+		assert.NoError(err)
+		if expected == nil {
+			assert.NoError(v.Verify(&sent))
+		} else {
+			assert.ErrorIs(v.Verify(&sent), expected)
+		}
+	}
+
+	// the delta proof of another transaction
+	otherXiW, otherDeltaW := setUpWitnesses(t)
+	_, otherDelta := assign(t, otherXiW, otherDeltaW)
+	_, err = New(xiKeys, deltaKeys, xi, otherDelta)
+	assert.ErrorIs(err, ErrCMXiMismatch)
+
+	replayed := *tx
+	replayed.DeltaPublic, err = prover.PublicWitness(otherDelta)
+	assert.NoError(err)
+	replayed.DeltaProof, err = prover.Prove(deltaKeys, otherDelta)
+	assert.NoError(err)
+	assert.ErrorIs(verifier.Verify(&replayed), ErrCMXiMismatch)
+
+	// a delta proof for the same xi but for other notes spent
+	deltaW.Nu = otherXiW.Nu2
+	_, delta = assign(t, xiW, deltaW)
+	_, err = New(xiKeys, deltaKeys, xi, delta)
+	assert.ErrorIs(err, ErrNuMismatch)
+
+	replayed = *tx
+	replayed.DeltaProof, err = prover.Prove(deltaKeys, delta)
+	assert.NoError(err)
+	replayed.DeltaPublic, err = prover.PublicWitness(delta)
+	assert.NoError(err)
+	assert.ErrorIs(verifier.Verify(&replayed), ErrNuMismatch)
+
+	// and claimed for the nu_2 of the xi proof
+	replayed.DeltaPublic = tx.DeltaPublic
+	assert.Error(verifier.Verify(&replayed))
+}
+
+func TestTransactionCensusRegistry(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	// the census of the payment and another one are registered, each by its signing
+	// and encryption keys
+	xiW, deltaW := setUpWitnesses(t)
+	var sigKey eddsa.PublicKey
+	_, err := sigKey.SetBytes(xiW.CensusPK.Bytes())
+	assert.NoError(err)
+	otherSig, err := eddsa.GenerateKey(rand.Reader)
+	assert.NoError(err)
+	otherEnc, err := elgamal.GenerateKey(rand.Reader)
+	assert.NoError(err)
+	leaves := []fr.Element{
+		registry.CensusLeaf(hashID, sigKey.A, deltaW.CensusPK.A),
+		registry.CensusLeaf(hashID, otherSig.PublicKey.A, otherEnc.PublicKey.A),
+	}
+	tree, err := merkle.New(hashID, censusDepth)
+	assert.NoError(err)
+	for _, leaf := range leaves {
+		_, err = tree.Append(leaf)
+		assert.NoError(err)
+	}
+
+	xiW.CensusPath, err = tree.Path(0)
+	assert.NoError(err)
+	xiW.CensusRoot, xiW.CensusEncPK = tree.Root(), deltaW.CensusPK
+	xiW.CensusBinding = registry.CensusBinding(hashID, leaves[0], xiW.Xi)
+	deltaW.CensusPath, deltaW.CensusRoot, deltaW.CensusSigPK = xiW.CensusPath, xiW.CensusRoot, xiW.CensusPK
+	deltaW.CensusBinding = xiW.CensusBinding
+	xi, delta := assign(t, xiW, deltaW)
+	xiPublic, err := prover.PublicWitness(xi)
+	assert.NoError(err)
+	deltaPublic, err := prover.PublicWitness(delta)
+	assert.NoError(err)
+	assert.NoError(checkBinding(xiPublic, deltaPublic))
+
+	// the report encrypted to the other census
+	other := deltaW
+	assert.NoError(other.SetReport(otherEnc.PublicKey, 0))
+	other.CensusSigPK = otherSig.Public()
+	other.CensusPath, err = tree.Path(1)
+	assert.NoError(err)
+	other.CensusBinding = registry.CensusBinding(hashID, leaves[1], xiW.Xi)
+	xi, delta = assign(t, xiW, other)
+	_, err = New(nil, nil, xi, delta)
+	assert.ErrorIs(err, ErrCensusMismatch)
+
+	// the report encrypted to a public key
+	other = deltaW
+	other.CensusPath = merkle.Path{}
+	xi, delta = assign(t, xiW, other)
+	_, err = New(nil, nil, xi, delta)
+	assert.ErrorIs(err, ErrCensusMismatch)
+}
+
+func setUpKeys(t *testing.T, circuit frontend.Circuit) *prover.Keys {
+	assert := test.NewAssert(t)
+
+	ccs, err := prover.Compile(circuit)
+	assert.NoError(err)
+
+	keys, err := prover.Setup(ccs)
+	assert.NoError(err)
+	return keys
+}
+
+func roundTrip(t *testing.T, w *witness.Witness) *witness.Witness {
+	assert := test.NewAssert(t)
+
+	data, err := w.MarshalBinary()
+	assert.NoError(err)
+	received := &witness.Witness{CurveID: ecc.BN254}
+	assert.NoError(received.UnmarshalBinary(data))
+	return received
+}
+
+func assign(t *testing.T, xiW xicircuit.Witness, deltaW deltacircuit.Witness) (*xicircuit.XiCircuit, *deltacircuit.DeltaCircuit) {
+	assert := test.NewAssert(t)
+
+	xi, err := xiW.Assign()
+	assert.NoError(err)
+	delta, err := deltaW.Assign()
+	assert.NoError(err)
+	return xi, delta
+}
+
+// setUpWitnesses returns the witnesses of a payment spending one note.
+func setUpWitnesses(t *testing.T) (xicircuit.Witness, deltacircuit.Witness) {
+	assert := test.NewAssert(t)
+
+	var xiIn xicircuit.XiWitnessInput
+	var deltaIn deltacircuit.DeltaWitnessInput
+
+	// the note spent
+	tree, err := merkle.New(hashID, treeDepth)
+	assert.NoError(err)
+	xiIn.Spent = make([]xicircuit.SpentNote, numInputs)
+	spent := &xiIn.Spent[0]
+	_, err = spent.Ask.SetRandom()
+	assert.NoError(err)
+	spent.Note, err = note.New(note.Address(hashID, spent.Ask), 3)
+	assert.NoError(err)
+	var cm fr.Element
+	cm.SetBytes(spent.Note.Commitment(hashID))
+	_, err = tree.Append(cm)
+	assert.NoError(err)
+	spent.Path, err = tree.Path(0)
+	assert.NoError(err)
+	xiIn.NoteRoot = tree.Root()
+
+	// the notes created
+	xiIn.Created = make([]note.Note, xicircuit.DefaultNumOutputs)
+	for j := range xiIn.Created {
+		var ask fr.Element
+		_, err = ask.SetRandom()
+		assert.NoError(err)
+		xiIn.Created[j], err = note.New(note.Address(hashID, ask), 1)
+		assert.NoError(err)
+	}
+	xiIn.Fee = 1
+
+	// xi = xi_U + xi_R is tossed with the census in the current epoch
+	censusKey, err := eddsa.GenerateKey(rand.Reader)
+	assert.NoError(err)
+	clock := census.WithClock(func() uint64 { return epoch })
+	signer := census.NewSigner(hashID, censusKey, clock)
+	nu1, err := xiIn.Nu1(hashID)
+	assert.NoError(err)
+	var nu fr.Element
+	nu.SetBytes(nu1)
+	toss, err := census.NewToss(hashID, nu)
+	assert.NoError(err)
+	res, err := census.NewService(signer).Issue(toss.Request())
+	assert.NoError(err)
+	assert.NoError(toss.Finish(census.NewVerifier(hashID, signer.Public(), clock), res, &xiIn))
+
+	xiW, err := xiIn.Build(hashID)
+	assert.NoError(err)
+
+	// the LDP of the ID, encrypted under the census key, for the xi committed by both proofs
+	deltaIn.Xi, deltaIn.RXi, deltaIn.Nu = xiW.Xi, xiW.RXi, xiW.Nu2
+	deltaIn.ID = big.NewInt(1)
+	encKey, err := elgamal.GenerateKey(rand.Reader)
+	assert.NoError(err)
+	deltaIn.CensusPK = encKey.PublicKey
+
+	// the registration authority signs a_pk||ID
+	deltaIn.ApkList = []fr.Element{spent.Note.Apk}
+	regKey, err := eddsa.GenerateKey(rand.Reader)
+	assert.NoError(err)
+	deltaIn.RegAuthoritySignature, err = regKey.Sign(deltacircuit.RegistrationData(hashID, deltaIn.ApkList, deltaIn.ID), hashID.New())
+	assert.NoError(err)
+	deltaIn.RegAuthorityPK = regKey.Public()
+
+	deltaW, err := deltaIn.Build(hashID)
+	assert.NoError(err)
+
+	return *xiW, *deltaW
+}
@@ -0,0 +1,198 @@
+// Package txcircuit composes the xi and delta circuits into a single circuit, so that a
+// payment is proven with one proof and one public witness instead of a transaction
+// of two proofs bound together. Xi is shared and committed to once, by the xi circuit,
+// and the ID reported is bound to the owners of the notes spent.
+//
+// With the registry, the report proves the registration of a single address, which
+// must then own all the notes spent.
+package txcircuit
+
+import (
+	"blockchain_DP/deltacircuit"
+	"blockchain_DP/hashfunctions"
+	"blockchain_DP/prover"
+	"blockchain_DP/xicircuit"
+	"fmt"
+
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+)
+
+type config struct {
+	hashID        hashfunctions.HashID
+	treeDepth     int
+	numOutputs    int
+	registryDepth int
+	idBits        int
+	censusDepth   int
+}
+
+// Option configures the circuit returned by NewTxCircuit.
+type Option func(*config)
+
+// WithHash selects the hash function used by both circuits.
+func WithHash(h hashfunctions.HashID) Option {
+	return func(cfg *config) {
+		cfg.hashID = h
+	}
+}
+
+// WithTreeDepth sets the depth of the note commitment tree.
+func WithTreeDepth(depth int) Option {
+	return func(cfg *config) {
+		cfg.treeDepth = depth
+	}
+}
+
+// WithOutputs sets the number of notes created by the transaction.
+func WithOutputs(numOutputs int) Option {
+	return func(cfg *config) {
+		cfg.numOutputs = numOutputs
+	}
+}
+
+// WithRegistry registers the ID in the registry of the registration authority, a tree
+// of the given depth, instead of by a signature over all its addresses.
+func WithRegistry(depth int) Option {
+	return func(cfg *config) {
+		cfg.registryDepth = depth
+	}
+}
+
+// WithIDBits reports IDs of nbBits bits bit by bit, each bit being encrypted on its own.
+func WithIDBits(nbBits int) Option {
+	return func(cfg *config) {
+		cfg.idBits = nbBits
+	}
+}
+
+// WithCensusRegistry hides the census keys of both circuits in the registry of census
+// keys, a tree of the given depth. Both circuits open the same census.
+func WithCensusRegistry(depth int) Option {
+	return func(cfg *config) {
+		cfg.censusDepth = depth
+	}
+}
+
+// TxCircuit proves both the xi circuit and the delta report for the xi of the
+// xi circuit.
+type TxCircuit struct {
+	Xi     xicircuit.XiCircuit
+	Report deltacircuit.Report
+}
+
+// NewTxCircuit returns the circuit spending up to numInputs notes, for an ID
+// registered with numApks addresses, to be compiled. numApks is ignored with WithRegistry.
+func NewTxCircuit(numInputs, numApks int, opts ...Option) *TxCircuit {
+	cfg := config{treeDepth: xicircuit.DefaultTreeDepth, numOutputs: xicircuit.DefaultNumOutputs}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &TxCircuit{
+		Xi: *xicircuit.NewXiCircuit(numInputs,
+			xicircuit.WithHash(cfg.hashID),
+			xicircuit.WithTreeDepth(cfg.treeDepth),
+			xicircuit.WithOutputs(cfg.numOutputs),
+			xicircuit.WithCensusRegistry(cfg.censusDepth)),
+		Report: *deltacircuit.NewReport(numApks,
+			deltacircuit.WithHash(cfg.hashID),
+			deltacircuit.WithRegistry(cfg.registryDepth),
+			deltacircuit.WithIDBits(cfg.idBits),
+			deltacircuit.WithCensusRegistry(cfg.censusDepth)),
+	}
+}
+
+// Define declares the constraints of the xi circuit, which commit to xi, followed by
+// those of the report for the same xi. The notes spent must be owned by addresses
+// registered to the ID of the report, so that a user can not report another ID, and a
+// hidden census must be the same in both, so that xi_R and the report are bound to a
+// single census.
+func (circuit *TxCircuit) Define(api frontend.API) error {
+	apks, err := circuit.Xi.DefineWithAddresses(api)
+	if err != nil {
+		return err
+	}
+	if err = circuit.Report.Define(api, circuit.Xi.Xi); err != nil {
+		return err
+	}
+
+	for i := range apks {
+		circuit.Report.AssertAddress(api, apks[i], circuit.Xi.Enabled[i])
+	}
+
+	for i := range circuit.Xi.CensusRegistry {
+		xiCensus, reportCensus := &circuit.Xi.CensusRegistry[i], &circuit.Report.CensusRegistry[i]
+		api.AssertIsEqual(xiCensus.Root, reportCensus.Root)
+		api.AssertIsEqual(xiCensus.SigKey.A.X, reportCensus.SigKey.A.X)
+		api.AssertIsEqual(xiCensus.SigKey.A.Y, reportCensus.SigKey.A.Y)
+		api.AssertIsEqual(xiCensus.EncKey.A.X, reportCensus.EncKey.A.X)
+		api.AssertIsEqual(xiCensus.EncKey.A.Y, reportCensus.EncKey.A.Y)
+	}
+	return nil
+}
+
+// Witness holds the native values of an assignment of the combined circuit.
+type Witness struct {
+	Xi xicircuit.Witness
+
+	// Only the report is assigned: xi, its commitment and nu come from the xi witness.
+	Delta deltacircuit.Witness
+}
+
+// Assign returns the circuit assignment of the witness.
+func (w *Witness) Assign() (*TxCircuit, error) {
+	xi, err := w.Xi.Assign()
+	if err != nil {
+		return nil, err
+	}
+	report, err := w.Delta.AssignReport()
+	if err != nil {
+		return nil, err
+	}
+	if !w.Delta.Xi.IsZero() && !w.Delta.Xi.Equal(&w.Xi.Xi) {
+		return nil, fmt.Errorf("assigning tx witness: the report is for another xi")
+	}
+
+	return &TxCircuit{Xi: *xi, Report: *report}, nil
+}
+
+// WitnessInput holds the protocol objects of a payment and of its report. The report
+// takes xi and nu_2 from the xi witness, so those of Delta are ignored.
+type WitnessInput struct {
+	Xi    xicircuit.XiWitnessInput
+	Delta deltacircuit.DeltaWitnessInput
+}
+
+// Build returns the witness of the payment and of its report.
+func (in *WitnessInput) Build(h hashfunctions.HashID) (*Witness, error) {
+	xi, err := in.Xi.Build(h)
+	if err != nil {
+		return nil, err
+	}
+
+	delta := in.Delta
+	delta.Xi, delta.RXi, delta.Nu = xi.Xi, xi.RXi, xi.Nu2
+	report, err := delta.Build(h)
+	if err != nil {
+		return nil, err
+	}
+	return &Witness{Xi: *xi, Delta: *report}, nil
+}
+
+// Assign builds the witness and returns its assignment and public witness.
+func (in *WitnessInput) Assign(h hashfunctions.HashID) (*TxCircuit, *witness.Witness, error) {
+	w, err := in.Build(h)
+	if err != nil {
+		return nil, nil, err
+	}
+	assignment, err := w.Assign()
+	if err != nil {
+		return nil, nil, err
+	}
+	public, err := prover.PublicWitness(assignment)
+	if err != nil {
+		return nil, nil, err
+	}
+	return assignment, public, nil
+}
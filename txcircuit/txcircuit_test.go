@@ -0,0 +1,346 @@
+package txcircuit
+
+import (
+	"blockchain_DP/census"
+	"blockchain_DP/deltacircuit"
+	"blockchain_DP/elgamal"
+	"blockchain_DP/hashfunctions"
+	"blockchain_DP/merkle"
+	"blockchain_DP/note"
+	"blockchain_DP/prover"
+	"blockchain_DP/registry"
+	"blockchain_DP/transaction"
+	"blockchain_DP/xicircuit"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/schema"
+	"github.com/consensys/gnark/test"
+)
+
+const (
+	treeDepth  = 16
+	numApks    = 1
+	inputValue = 5
+)
+
+func TestTxCircuit(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	vals := setUpWitness(t, 2, hashfunctions.MiMC)
+	circuit := NewTxCircuit(2, numApks, WithTreeDepth(treeDepth))
+	assignment, err := vals.Assign()
+	assert.NoError(err)
+	assert.NoError(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+
+	// the coins of the report must be those of the xi committed to by the xi circuit
+	other := vals
+	other.Delta.Coin0 = []int{1 - vals.Delta.Coin0[0]}
+	assignment, err = other.Assign()
+	assert.NoError(err)
+	assert.Error(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+
+	other = setUpWitness(t, 2, hashfunctions.MiMC)
+	other.Xi = vals.Xi
+	_, err = other.Assign()
+	assert.Error(err, "report for another xi")
+}
+
+func TestTxCircuitOwner(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	const registryDepth = 8
+	vals := setUpWitness(t, 2, hashfunctions.MiMC)
+	owner := note.Address(hashfunctions.MiMC, vals.Xi.AskList[0])
+
+	var others [2]fr.Element
+	for i := range others {
+		_, err := others[i].SetRandom()
+		assert.NoError(err)
+	}
+
+	// the owner of the notes is one of the addresses signed
+	circuit := NewTxCircuit(2, 3, WithTreeDepth(treeDepth))
+	signRegistration(t, &vals.Delta, hashfunctions.MiMC, others[0], owner, others[1])
+	assignment, err := vals.Assign()
+	assert.NoError(err)
+	assert.NoError(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+
+	// the ID of someone else
+	signRegistration(t, &vals.Delta, hashfunctions.MiMC, others[0], others[1], others[1])
+	assignment, err = vals.Assign()
+	assert.NoError(err)
+	assert.Error(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+
+	// the same with the registry
+	reg, err := registry.New(hashfunctions.MiMC, registryDepth)
+	assert.NoError(err)
+	assert.NoError(reg.Register(owner, vals.Delta.ID))
+	assert.NoError(reg.Register(others[0], big.NewInt(2)))
+	vals.Delta.RegistryRoot = reg.Root()
+
+	circuit = NewTxCircuit(2, 0, WithTreeDepth(treeDepth), WithRegistry(registryDepth))
+	vals.Delta.Apk = owner
+	vals.Delta.RegistryPath, err = reg.Path(owner)
+	assert.NoError(err)
+	assignment, err = vals.Assign()
+	assert.NoError(err)
+	assert.NoError(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+
+	// an address of the same ID which does not own the notes
+	assert.NoError(reg.Register(others[1], vals.Delta.ID))
+	vals.Delta.RegistryRoot = reg.Root()
+	vals.Delta.Apk = others[1]
+	vals.Delta.RegistryPath, err = reg.Path(others[1])
+	assert.NoError(err)
+	assignment, err = vals.Assign()
+	assert.NoError(err)
+	assert.Error(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+}
+
+func TestTxCircuitCensusRegistry(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	const censusDepth = 8
+	vals := setUpWitness(t, 1, hashfunctions.MiMC)
+
+	// the census of the payment and another one, each registered by a single leaf
+	// binding its signing and encryption keys
+	var censusPK eddsa.PublicKey
+	_, err := censusPK.SetBytes(vals.Xi.CensusPK.Bytes())
+	assert.NoError(err)
+	otherSig, err := eddsa.GenerateKey(rand.Reader)
+	assert.NoError(err)
+	otherEnc, err := elgamal.GenerateKey(rand.Reader)
+	assert.NoError(err)
+	leaves := []fr.Element{
+		registry.CensusLeaf(hashfunctions.MiMC, censusPK.A, vals.Delta.CensusPK.A),
+		registry.CensusLeaf(hashfunctions.MiMC, otherSig.PublicKey.A, otherEnc.PublicKey.A),
+	}
+	tree, err := merkle.New(hashfunctions.MiMC, censusDepth)
+	assert.NoError(err)
+	for _, leaf := range leaves {
+		_, err = tree.Append(leaf)
+		assert.NoError(err)
+	}
+	vals.Xi.CensusPath, err = tree.Path(0)
+	assert.NoError(err)
+	vals.Delta.CensusPath = vals.Xi.CensusPath
+	vals.Xi.CensusRoot, vals.Delta.CensusRoot = tree.Root(), tree.Root()
+	vals.Xi.CensusEncPK, vals.Delta.CensusSigPK = vals.Delta.CensusPK, vals.Xi.CensusPK
+	vals.Xi.CensusBinding = registry.CensusBinding(hashfunctions.MiMC, leaves[0], vals.Xi.Xi)
+	vals.Delta.CensusBinding = vals.Xi.CensusBinding
+
+	circuit := NewTxCircuit(1, numApks, WithTreeDepth(treeDepth), WithCensusRegistry(censusDepth))
+	assignment, err := vals.Assign()
+	assert.NoError(err)
+	assert.NoError(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+	_, err = prover.Compile(circuit)
+	assert.NoError(err)
+
+	// neither census key is a public input
+	var public []string
+	_, err = schema.Parse(circuit, tVariable, func(visibility schema.Visibility, name string, _ reflect.Value) error {
+		if visibility == schema.Public {
+			public = append(public, name)
+		}
+		return nil
+	})
+	assert.NoError(err)
+	for _, name := range public {
+		assert.False(strings.Contains(name, "CensusPK"), name)
+	}
+	assert.Contains(public, "Report_CensusRegistry_0_Root")
+
+	// xi_R signed by the census of the payment, the report encrypted to the other one
+	other := vals
+	other.Delta.CensusPK, other.Delta.CensusSigPK = otherEnc.PublicKey, otherSig.Public()
+	other.Delta.CensusPath, err = tree.Path(1)
+	assert.NoError(err)
+	other.Delta.CensusBinding = registry.CensusBinding(hashfunctions.MiMC, leaves[1], vals.Xi.Xi)
+	assignment, err = other.Assign()
+	assert.NoError(err)
+	assert.Error(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+}
+
+var tVariable = reflect.ValueOf(struct{ A frontend.Variable }{}).FieldByName("A").Type()
+
+// TestTxCircuitBenchmark compares one proof of the combined circuit with the two
+// proofs of a transaction.
+func TestTxCircuitBenchmark(t *testing.T) {
+	for _, numInputs := range []int{
+		1, 2, 4,
+	} {
+		timeS, timeP, timeV := RunBenchmark(t, numInputs, hashfunctions.MiMC)
+		fmt.Println("combined", numInputs, "Setup time:", timeS)
+		fmt.Println("combined", numInputs, "Proof time:", timeP)
+		fmt.Println("combined", numInputs, "Verification time:", timeV)
+
+		timeS, timeP, timeV = RunTransactionBenchmark(t, numInputs, hashfunctions.MiMC)
+		fmt.Println("two proofs", numInputs, "Setup time:", timeS)
+		fmt.Println("two proofs", numInputs, "Proof time:", timeP)
+		fmt.Println("two proofs", numInputs, "Verification time:", timeV)
+	}
+}
+
+func RunBenchmark(t *testing.T, numInputs int, hashID hashfunctions.HashID) (time.Duration, time.Duration, time.Duration) {
+	assert := test.NewAssert(t)
+
+	vals := setUpWitness(t, numInputs, hashID)
+	circuit := NewTxCircuit(numInputs, numApks, WithHash(hashID), WithTreeDepth(treeDepth))
+	assignment, err := vals.Assign()
+	assert.NoError(err)
+
+	ccs, err := prover.Compile(circuit)
+	assert.NoError(err)
+	fmt.Println("combined", numInputs, "Total", ccs.GetNbConstraints(), "constraints")
+
+	t1 := time.Now()
+	keys, err := prover.Setup(ccs)
+	assert.NoError(err)
+	timeS := time.Since(t1)
+
+	publicWitness, err := prover.PublicWitness(assignment)
+	assert.NoError(err)
+
+	t1 = time.Now()
+	proof, err := prover.Prove(keys, assignment)
+	assert.NoError(err)
+	timeP := time.Since(t1)
+
+	t1 = time.Now()
+	assert.NoError(prover.Verify(keys.VK, proof, publicWitness))
+	timeV := time.Since(t1)
+
+	return timeS, timeP, timeV
+}
+
+func RunTransactionBenchmark(t *testing.T, numInputs int, hashID hashfunctions.HashID) (time.Duration, time.Duration, time.Duration) {
+	assert := test.NewAssert(t)
+
+	vals := setUpWitness(t, numInputs, hashID)
+	xiCircuit := xicircuit.NewXiCircuit(numInputs, xicircuit.WithHash(hashID), xicircuit.WithTreeDepth(treeDepth))
+	deltaCircuit := deltacircuit.NewDeltaCircuit(numApks, deltacircuit.WithHash(hashID))
+	xi, err := vals.Xi.Assign()
+	assert.NoError(err)
+	delta, err := vals.Delta.Assign()
+	assert.NoError(err)
+
+	xiCCS, err := prover.Compile(xiCircuit)
+	assert.NoError(err)
+	deltaCCS, err := prover.Compile(deltaCircuit)
+	assert.NoError(err)
+	fmt.Println("two proofs", numInputs, "Total", xiCCS.GetNbConstraints()+deltaCCS.GetNbConstraints(), "constraints")
+
+	t1 := time.Now()
+	xiKeys, err := prover.Setup(xiCCS)
+	assert.NoError(err)
+	deltaKeys, err := prover.Setup(deltaCCS)
+	assert.NoError(err)
+	timeS := time.Since(t1)
+
+	// the census signs with the default clock; a second epoch spares a rollover
+	verifier, err := transaction.NewVerifier(xiKeys.VK, deltaKeys.VK, xiCircuit, deltaCircuit,
+		census.TimeClock(census.DefaultEpochLength), 2)
+	assert.NoError(err)
+
+	t1 = time.Now()
+	tx, err := transaction.New(xiKeys, deltaKeys, xi, delta)
+	assert.NoError(err)
+	timeP := time.Since(t1)
+
+	t1 = time.Now()
+	assert.NoError(verifier.Verify(tx))
+	timeV := time.Since(t1)
+
+	return timeS, timeP, timeV
+}
+
+// setUpWitness returns the witness of a payment spending numInputs notes.
+func setUpWitness(t *testing.T, numInputs int, hashID hashfunctions.HashID) Witness {
+	assert := test.NewAssert(t)
+
+	var in WitnessInput
+
+	// the notes spent, owned by the same a_sk
+	tree, err := merkle.New(hashID, treeDepth)
+	assert.NoError(err)
+	var ask fr.Element
+	_, err = ask.SetRandom()
+	assert.NoError(err)
+	in.Xi.Spent = make([]xicircuit.SpentNote, numInputs)
+	for i := range in.Xi.Spent {
+		in.Xi.Spent[i].Ask = ask
+		in.Xi.Spent[i].Note, err = note.New(note.Address(hashID, ask), inputValue)
+		assert.NoError(err)
+		var cm fr.Element
+		cm.SetBytes(in.Xi.Spent[i].Note.Commitment(hashID))
+		_, err = tree.Append(cm)
+		assert.NoError(err)
+	}
+	for i := range in.Xi.Spent {
+		in.Xi.Spent[i].Path, err = tree.Path(uint64(i))
+		assert.NoError(err)
+	}
+	in.Xi.NoteRoot = tree.Root()
+
+	// the notes created
+	in.Xi.Created = make([]note.Note, xicircuit.DefaultNumOutputs)
+	for j, value := range []uint64{inputValue*uint64(numInputs) - 3, 2} {
+		var outAsk fr.Element
+		_, err = outAsk.SetRandom()
+		assert.NoError(err)
+		in.Xi.Created[j], err = note.New(note.Address(hashID, outAsk), value)
+		assert.NoError(err)
+	}
+	in.Xi.Fee = 1
+
+	// xi is tossed with the census, which signs cm_u||nu_1||xi_R in the current epoch
+	censusKey, err := eddsa.GenerateKey(rand.Reader)
+	assert.NoError(err)
+	signer := census.NewSigner(hashID, censusKey)
+	nu1, err := in.Xi.Nu1(hashID)
+	assert.NoError(err)
+	var nu fr.Element
+	nu.SetBytes(nu1)
+	toss, err := census.NewToss(hashID, nu)
+	assert.NoError(err)
+	res, err := census.NewService(signer).Issue(toss.Request())
+	assert.NoError(err)
+	assert.NoError(toss.Finish(census.NewVerifier(hashID, signer.Public()), res, &in.Xi))
+
+	// the LDP of the ID, encrypted under the census key
+	in.Delta.ID = big.NewInt(1)
+	encKey, err := elgamal.GenerateKey(rand.Reader)
+	assert.NoError(err)
+	in.Delta.CensusPK = encKey.PublicKey
+
+	vals, err := in.Build(hashID)
+	assert.NoError(err)
+	signRegistration(t, &vals.Delta, hashID, note.Address(hashID, ask))
+
+	return *vals
+}
+
+// signRegistration registers apks to the ID of w by a signature of the registration
+// authority over apks||ID.
+func signRegistration(t *testing.T, w *deltacircuit.Witness, hashID hashfunctions.HashID, apks ...fr.Element) {
+	assert := test.NewAssert(t)
+
+	w.ApkList = apks
+	regKey, err := eddsa.GenerateKey(rand.Reader)
+	assert.NoError(err)
+	w.RegAuthoritySignature, err = regKey.Sign(deltacircuit.RegistrationData(hashID, apks, w.ID), hashID.New())
+	assert.NoError(err)
+	w.RegAuthorityPK = regKey.Public()
+}
@@ -0,0 +1,138 @@
+package xicircuit
+
+import (
+	"blockchain_DP/elgamal"
+	"blockchain_DP/hashfunctions"
+	"blockchain_DP/merkle"
+	"blockchain_DP/note"
+	"blockchain_DP/prover"
+	"blockchain_DP/registry"
+	"fmt"
+
+	fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	eddsabn254 "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+	"github.com/consensys/gnark-crypto/signature"
+	"github.com/consensys/gnark/backend/witness"
+)
+
+// XiWitnessInput holds the protocol objects of a payment: the notes spent and created,
+// and the coin toss of xi with the census. Build derives the other values of the
+// witness from them.
+type XiWitnessInput struct {
+	Spent    []SpentNote
+	NoteRoot fr.Element
+	Created  []note.Note
+	Fee      uint64
+
+	// Slots is the number of input slots of the circuit, the notes spent if 0
+	Slots int
+
+	// The share xi_U of the user and the randomness of its commitment, the share xi_R of
+	// the census and its signature
+	XiUser          fr.Element
+	RXiUser         fr.Element
+	XiCensus        fr.Element
+	Epoch           uint64
+	CensusPK        signature.PublicKey
+	CensusSignature []byte
+
+	// The census hidden in the registry of census keys, if CensusPath is set, and its
+	// ElGamal key
+	CensusPath  merkle.Path
+	CensusRoot  fr.Element
+	CensusEncPK elgamal.PublicKey
+}
+
+// inputs returns the inputs of the notes spent, padded to the slots of the circuit.
+func (in *XiWitnessInput) inputs(h hashfunctions.HashID) (Inputs, error) {
+	inputs, err := InputsFromNotes(h, in.Spent)
+	if err != nil {
+		return Inputs{}, err
+	}
+	slots := in.Slots
+	if slots == 0 {
+		slots = len(in.Spent)
+	}
+	if err = inputs.Pad(h, slots); err != nil {
+		return Inputs{}, err
+	}
+	return inputs, nil
+}
+
+// Nu1 returns nu_1 = PRF(omega||1) of the notes spent, sent to the census with the
+// commitment to xi_U before building the witness.
+func (in *XiWitnessInput) Nu1(h hashfunctions.HashID) ([]byte, error) {
+	inputs, err := in.inputs(h)
+	if err != nil {
+		return nil, err
+	}
+	return h.PRFNu(inputs.SpentOmega(), fr.NewElement(1)), nil
+}
+
+// Build returns the witness of the payment: the serial numbers, nu_1, nu_2, xi and the
+// commitments are derived, and the randomness of the commitments to omega and xi is
+// sampled.
+func (in *XiWitnessInput) Build(h hashfunctions.HashID) (*Witness, error) {
+	var w Witness
+	var err error
+
+	if w.Inputs, err = in.inputs(h); err != nil {
+		return nil, fmt.Errorf("building xi witness: %w", err)
+	}
+	w.NoteRoot = in.NoteRoot
+	w.Outputs = OutputsFromNotes(h, in.Created)
+	w.Fee = in.Fee
+
+	w.Nu1 = h.PRFNu(w.SpentOmega(), fr.NewElement(1))
+	w.Nu2 = h.PRFNu(w.SpentOmega(), fr.NewElement(2))
+	if _, err = w.ROmega.SetRandom(); err != nil {
+		return nil, err
+	}
+	w.CMOmega = h.Commit(w.ROmega, w.Omega...)
+
+	w.XiUser, w.RXiUser, w.XiCensus = in.XiUser, in.RXiUser, in.XiCensus
+	w.CMXiUser = h.Commit(w.RXiUser, w.XiUser)
+	w.Xi.Add(&w.XiUser, &w.XiCensus)
+	if _, err = w.RXi.SetRandom(); err != nil {
+		return nil, err
+	}
+	w.CMXi = h.Commit(w.RXi, w.Xi)
+
+	w.Epoch = in.Epoch
+	w.SignedData = SignedData(h, w.CMXiUser, w.Nu1, w.XiCensus, w.Epoch)
+	w.CensusPK = in.CensusPK
+	w.CensusSignature = in.CensusSignature
+	w.CensusPath, w.CensusRoot = in.CensusPath, in.CensusRoot
+	if in.CensusPath.Siblings != nil {
+		var sigPK eddsabn254.PublicKey
+		if _, err = sigPK.SetBytes(in.CensusPK.Bytes()); err != nil {
+			return nil, fmt.Errorf("building xi witness: %w", err)
+		}
+		w.CensusEncPK = in.CensusEncPK
+		w.CensusBinding = registry.CensusBinding(h, registry.CensusLeaf(h, sigPK.A, in.CensusEncPK.A), w.Xi)
+	}
+
+	return &w, nil
+}
+
+// Assign builds the witness and returns its assignment and public witness.
+func (in *XiWitnessInput) Assign(h hashfunctions.HashID) (*XiCircuit, *witness.Witness, error) {
+	w, err := in.Build(h)
+	if err != nil {
+		return nil, nil, err
+	}
+	return w.AssignWithPublic()
+}
+
+// AssignWithPublic returns the assignment of the witness and its public witness.
+func (w *Witness) AssignWithPublic() (*XiCircuit, *witness.Witness, error) {
+	assignment, err := w.Assign()
+	if err != nil {
+		return nil, nil, err
+	}
+	public, err := prover.PublicWitness(assignment)
+	if err != nil {
+		return nil, nil, err
+	}
+	return assignment, public, nil
+}
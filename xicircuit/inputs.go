@@ -0,0 +1,192 @@
+package xicircuit
+
+import (
+	"blockchain_DP/hashfunctions"
+	"blockchain_DP/merkle"
+	"blockchain_DP/note"
+	"errors"
+	"fmt"
+	"sort"
+
+	fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
+)
+
+var (
+	ErrNotOwner       = errors.New("a_sk does not match the a_pk of the note")
+	ErrTooManyInputs  = errors.New("more inputs than slots in the circuit")
+	ErrNoInputs       = errors.New("at least one note must be spent")
+	ErrUnsorted       = errors.New("inputs are not sorted by omega")
+	ErrDuplicateInput = errors.New("note spent twice")
+	ErrDuplicateSN    = errors.New("serial number appears twice")
+	ErrDummyOrder     = errors.New("dummy slots must come after the notes spent")
+	ErrInputLengths   = errors.New("per-input witnesses of different lengths")
+)
+
+// SpentNote is an input of the xi circuit: a note, the a_sk of its owner and the
+// authentication path of its commitment in the note commitment tree.
+type SpentNote struct {
+	Note note.Note
+	Ask  fr.Element
+	Path merkle.Path
+}
+
+// Inputs holds the per-input witnesses of the xi circuit, sorted by rho, followed
+// by the dummy slots.
+type Inputs struct {
+	Omega     []fr.Element
+	AskList   []fr.Element
+	SNOldList []fr.Element
+
+	// Enabled is false for dummy slots. A nil Enabled means every slot spends a note.
+	Enabled []bool
+
+	NoteValues []uint64
+	NoteRList  []fr.Element
+	NotePaths  []merkle.Path
+}
+
+// InputsFromNotes derives the per-input witnesses of the spent notes.
+// The inputs are sorted by rho, as required by the circuit.
+func InputsFromNotes(h hashfunctions.HashID, notes []SpentNote) (Inputs, error) {
+	if err := h.Check(); err != nil {
+		return Inputs{}, err
+	}
+
+	sorted := make([]SpentNote, len(notes))
+	copy(sorted, notes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Note.Rho.Cmp(&sorted[j].Note.Rho) < 0
+	})
+
+	var in Inputs
+	in.Omega = make([]fr.Element, len(sorted))
+	in.AskList = make([]fr.Element, len(sorted))
+	in.SNOldList = make([]fr.Element, len(sorted))
+	in.Enabled = make([]bool, len(sorted))
+	in.NoteValues = make([]uint64, len(sorted))
+	in.NoteRList = make([]fr.Element, len(sorted))
+	in.NotePaths = make([]merkle.Path, len(sorted))
+	for i := range sorted {
+		apk := note.Address(h, sorted[i].Ask)
+		if !apk.Equal(&sorted[i].Note.Apk) {
+			return Inputs{}, ErrNotOwner
+		}
+		in.Omega[i] = sorted[i].Note.Rho
+		in.AskList[i] = sorted[i].Ask
+		in.SNOldList[i] = sorted[i].Note.SerialNumber(h, sorted[i].Ask)
+		in.Enabled[i] = true
+		in.NoteValues[i] = sorted[i].Note.Value
+		in.NoteRList[i] = sorted[i].Note.R
+		in.NotePaths[i] = sorted[i].Path
+	}
+
+	if err := in.Check(); err != nil {
+		return Inputs{}, err
+	}
+	return in, nil
+}
+
+// Check returns a descriptive error if the inputs would not satisfy the circuit
+// because of their order or of duplicates: omegas of the notes spent must be strictly
+// increasing and serial numbers pairwise distinct.
+func (in *Inputs) Check() error {
+	if err := in.checkLengths(); err != nil {
+		return err
+	}
+	if len(in.Omega) == 0 || !in.enabled(0) {
+		return ErrNoInputs
+	}
+
+	for i := 1; i < len(in.Omega); i++ {
+		if !in.enabled(i) {
+			continue
+		}
+		if !in.enabled(i - 1) {
+			return fmt.Errorf("%w: slot %d spends a note after a dummy slot", ErrDummyOrder, i)
+		}
+		switch in.Omega[i-1].Cmp(&in.Omega[i]) {
+		case 0:
+			return fmt.Errorf("%w: inputs %d and %d have the same omega %s", ErrDuplicateInput, i-1, i, in.Omega[i].String())
+		case 1:
+			return fmt.Errorf("%w: omega of input %d is greater than omega of input %d", ErrUnsorted, i-1, i)
+		}
+	}
+
+	seen := make(map[fr.Element]int, len(in.SNOldList))
+	for i := range in.SNOldList {
+		if j, ok := seen[in.SNOldList[i]]; ok {
+			return fmt.Errorf("%w: slots %d and %d have the serial number %s", ErrDuplicateSN, j, i, in.SNOldList[i].String())
+		}
+		seen[in.SNOldList[i]] = i
+	}
+
+	return nil
+}
+
+// Pad fills the inputs with dummy slots up to the numInputs slots of the circuit.
+// The dummies have random omega and a_sk, the serial number derived from them, and no
+// value.
+func (in *Inputs) Pad(h hashfunctions.HashID, numInputs int) error {
+	if err := in.checkLengths(); err != nil {
+		return err
+	}
+	if len(in.Omega) == 0 {
+		return ErrNoInputs
+	}
+	if len(in.Omega) > numInputs {
+		return ErrTooManyInputs
+	}
+	if in.Enabled == nil {
+		in.Enabled = make([]bool, len(in.Omega))
+		for i := range in.Enabled {
+			in.Enabled[i] = true
+		}
+	}
+
+	depth := len(in.NotePaths[0].Siblings)
+	for len(in.Omega) < numInputs {
+		var omega, ask, r fr.Element
+		for _, e := range []*fr.Element{&omega, &ask, &r} {
+			if _, err := e.SetRandom(); err != nil {
+				return err
+			}
+		}
+		sn := h.PRFSN(ask, omega)
+
+		in.Omega = append(in.Omega, omega)
+		in.AskList = append(in.AskList, ask)
+		in.SNOldList = append(in.SNOldList, sn)
+		in.Enabled = append(in.Enabled, false)
+		in.NoteValues = append(in.NoteValues, 0)
+		in.NoteRList = append(in.NoteRList, r)
+		in.NotePaths = append(in.NotePaths, merkle.Path{Siblings: make([]fr.Element, depth)})
+	}
+
+	return nil
+}
+
+// SpentOmega returns the omegas the nus are computed from, those of the notes spent:
+// the dummy slots are skipped.
+func (in *Inputs) SpentOmega() []fr.Element {
+	omega := make([]fr.Element, 0, len(in.Omega))
+	for i := range in.Omega {
+		if in.enabled(i) {
+			omega = append(omega, in.Omega[i])
+		}
+	}
+	return omega
+}
+
+// checkLengths checks that every per-input witness has a value per slot.
+func (in *Inputs) checkLengths() error {
+	n := len(in.Omega)
+	if len(in.AskList) != n || len(in.SNOldList) != n || len(in.NoteValues) != n ||
+		len(in.NoteRList) != n || len(in.NotePaths) != n || (in.Enabled != nil && len(in.Enabled) != n) {
+		return ErrInputLengths
+	}
+	return nil
+}
+
+func (in *Inputs) enabled(i int) bool {
+	return in.Enabled == nil || in.Enabled[i]
+}
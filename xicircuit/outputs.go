@@ -0,0 +1,77 @@
+package xicircuit
+
+import (
+	"blockchain_DP/hashfunctions"
+	"blockchain_DP/note"
+	"errors"
+	"fmt"
+	"math/bits"
+
+	fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
+)
+
+var (
+	ErrUnbalanced = errors.New("values spent do not match the values created plus the fee")
+	ErrOverflow   = errors.New("sum of the values overflows")
+)
+
+// Outputs holds the notes created by the xi circuit and their commitments.
+type Outputs struct {
+	OutApkList []fr.Element
+	OutValues  []uint64
+	OutRhoList []fr.Element
+	OutRList   []fr.Element
+	OutCMList  []fr.Element
+}
+
+// OutputsFromNotes computes the commitments of the notes created.
+func OutputsFromNotes(h hashfunctions.HashID, notes []note.Note) Outputs {
+
+	var out Outputs
+	out.OutApkList = make([]fr.Element, len(notes))
+	out.OutValues = make([]uint64, len(notes))
+	out.OutRhoList = make([]fr.Element, len(notes))
+	out.OutRList = make([]fr.Element, len(notes))
+	out.OutCMList = make([]fr.Element, len(notes))
+	for j := range notes {
+		out.OutApkList[j] = notes[j].Apk
+		out.OutValues[j] = notes[j].Value
+		out.OutRhoList[j] = notes[j].Rho
+		out.OutRList[j] = notes[j].R
+		out.OutCMList[j].SetBytes(notes[j].Commitment(h))
+	}
+
+	return out
+}
+
+// CheckBalance returns an error if the values of the inputs are not the values of
+// the outputs plus fee.
+func CheckBalance(in *Inputs, out *Outputs, fee uint64) error {
+	spent, err := sum(in.NoteValues)
+	if err != nil {
+		return err
+	}
+	created, err := sum(out.OutValues)
+	if err != nil {
+		return err
+	}
+	created, err = sum([]uint64{created, fee})
+	if err != nil {
+		return err
+	}
+	if spent != created {
+		return fmt.Errorf("%w: %d spent, %d created with a fee of %d", ErrUnbalanced, spent, created-fee, fee)
+	}
+	return nil
+}
+
+func sum(values []uint64) (uint64, error) {
+	var total, carry uint64
+	for _, v := range values {
+		total, carry = bits.Add64(total, v, 0)
+		if carry != 0 {
+			return 0, ErrOverflow
+		}
+	}
+	return total, nil
+}
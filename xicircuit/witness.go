@@ -0,0 +1,160 @@
+package xicircuit
+
+import (
+	"blockchain_DP/elgamal"
+	"blockchain_DP/hashfunctions"
+	"blockchain_DP/merkle"
+	"blockchain_DP/registry"
+	"fmt"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	eddsabn254 "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+	"github.com/consensys/gnark-crypto/signature"
+	"github.com/consensys/gnark/frontend"
+	eddsa "github.com/consensys/gnark/std/signature/eddsa"
+)
+
+// Witness holds the native values of an assignment of the xi circuit.
+type Witness struct {
+	Inputs
+	NoteRoot fr.Element
+
+	Outputs
+	Fee uint64
+
+	Nu1     []byte
+	Nu2     []byte
+	ROmega  fr.Element
+	CMOmega []byte
+
+	XiUser   fr.Element
+	RXiUser  fr.Element
+	XiCensus fr.Element
+	Xi       fr.Element
+	RXi      fr.Element
+	CMXi     []byte
+	CMXiUser []byte
+
+	SignedData []byte
+	Epoch      uint64
+
+	CensusPK        signature.PublicKey
+	CensusSignature []byte
+
+	// The census hidden in the registry of census keys, instead of its key being public,
+	// if CensusPath is set: its ElGamal key and the CensusBinding of its leaf with xi
+	CensusPath    merkle.Path
+	CensusRoot    fr.Element
+	CensusEncPK   elgamal.PublicKey
+	CensusBinding fr.Element
+}
+
+// SignedData computes H(cm_u||nu_1||xi_R||epoch), the data signed by the census with
+// xi_R for the given epoch.
+func SignedData(h hashfunctions.HashID, cmXiUser, nu1 []byte, xiCensus fr.Element, epoch uint64) []byte {
+	e := fr.NewElement(epoch)
+
+	hfunc := h.New()
+	hfunc.Write(cmXiUser)
+	hfunc.Write(nu1)
+	hfunc.Write(xiCensus.Marshal())
+	hfunc.Write(e.Marshal())
+	return hfunc.Sum(nil)
+}
+
+// Assign returns the circuit assignment of the witness.
+func (w *Witness) Assign() (assignment *XiCircuit, err error) {
+	// eddsa assignments panic on malformed keys and signatures
+	defer func() {
+		if r := recover(); r != nil {
+			assignment, err = nil, fmt.Errorf("assigning xi witness: %v", r)
+		}
+	}()
+
+	numInputs := len(w.Omega)
+	if len(w.AskList) != numInputs || len(w.SNOldList) != numInputs || len(w.NoteValues) != numInputs ||
+		len(w.NoteRList) != numInputs || len(w.NotePaths) != numInputs ||
+		(w.Enabled != nil && len(w.Enabled) != numInputs) {
+		return nil, fmt.Errorf("assigning xi witness: inputs of different lengths")
+	}
+	if err := w.Check(); err != nil {
+		return nil, fmt.Errorf("assigning xi witness: %w", err)
+	}
+
+	numOutputs := len(w.OutValues)
+	if len(w.OutApkList) != numOutputs || len(w.OutRhoList) != numOutputs || len(w.OutRList) != numOutputs ||
+		len(w.OutCMList) != numOutputs {
+		return nil, fmt.Errorf("assigning xi witness: outputs of different lengths")
+	}
+	if err := CheckBalance(&w.Inputs, &w.Outputs, w.Fee); err != nil {
+		return nil, fmt.Errorf("assigning xi witness: %w", err)
+	}
+
+	assignment = &XiCircuit{}
+	assignment.Omega = make([]frontend.Variable, numInputs)
+	assignment.AskList = make([]frontend.Variable, numInputs)
+	assignment.SNOldList = make([]frontend.Variable, numInputs)
+	assignment.Enabled = make([]frontend.Variable, numInputs)
+	assignment.NoteValues = make([]frontend.Variable, numInputs)
+	assignment.NoteRList = make([]frontend.Variable, numInputs)
+	for i := 0; i < numInputs; i++ {
+		assignment.Omega[i] = w.Omega[i]
+		assignment.AskList[i] = w.AskList[i]
+		assignment.SNOldList[i] = w.SNOldList[i]
+		assignment.Enabled[i] = 0
+		if w.enabled(i) {
+			assignment.Enabled[i] = 1
+		}
+		assignment.NoteValues[i] = w.NoteValues[i]
+		assignment.NoteRList[i] = w.NoteRList[i]
+		assignment.NotePaths = append(assignment.NotePaths, w.NotePaths[i].Assign())
+	}
+	assignment.NoteRoot = w.NoteRoot
+
+	assignment.OutApkList = make([]frontend.Variable, numOutputs)
+	assignment.OutValues = make([]frontend.Variable, numOutputs)
+	assignment.OutRhoList = make([]frontend.Variable, numOutputs)
+	assignment.OutRList = make([]frontend.Variable, numOutputs)
+	assignment.OutCMList = make([]frontend.Variable, numOutputs)
+	for j := 0; j < numOutputs; j++ {
+		assignment.OutApkList[j] = w.OutApkList[j]
+		assignment.OutValues[j] = w.OutValues[j]
+		assignment.OutRhoList[j] = w.OutRhoList[j]
+		assignment.OutRList[j] = w.OutRList[j]
+		assignment.OutCMList[j] = w.OutCMList[j]
+	}
+	assignment.Fee = w.Fee
+
+	assignment.Nu1 = w.Nu1
+	assignment.Nu2 = w.Nu2
+	assignment.ROmega = w.ROmega
+	assignment.CMOmega = w.CMOmega
+
+	assignment.XiUser = w.XiUser
+	assignment.RXiUser = w.RXiUser
+	assignment.XiCensus = w.XiCensus
+	assignment.Xi = w.Xi
+	assignment.RXi = w.RXi
+	assignment.CMXi = w.CMXi
+	assignment.CMXiUser = w.CMXiUser
+
+	assignment.CensusSignedData = w.SignedData
+	assignment.Epoch = w.Epoch
+
+	assignment.CensusSignature.Assign(ecc.BN254, w.CensusSignature)
+	if w.CensusPath.Siblings != nil {
+		var censusPK eddsabn254.PublicKey
+		if _, err := censusPK.SetBytes(w.CensusPK.Bytes()); err != nil {
+			return nil, fmt.Errorf("assigning xi witness: %w", err)
+		}
+		assignment.CensusRegistry = []registry.HiddenCensus{
+			registry.AssignHiddenCensus(censusPK.A, w.CensusEncPK.A, w.CensusPath, w.CensusRoot, w.CensusBinding),
+		}
+	} else {
+		assignment.CensusPK = make([]eddsa.PublicKey, 1)
+		assignment.CensusPK[0].Assign(ecc.BN254, w.CensusPK.Bytes())
+	}
+
+	return assignment, nil
+}
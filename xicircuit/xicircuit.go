@@ -1,17 +1,81 @@
 package xicircuit
 
 import (
+	"blockchain_DP/hashfunctions"
+	"blockchain_DP/merkle"
+	"blockchain_DP/note"
+	"blockchain_DP/registry"
+
 	fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
 	tedwards "github.com/consensys/gnark-crypto/ecc/twistededwards"
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/std/algebra/twistededwards"
-	"github.com/consensys/gnark/std/hash/mimc"
 	eddsa "github.com/consensys/gnark/std/signature/eddsa"
 )
 
-type xiCircuit struct {
+const (
+	// DefaultTreeDepth is the depth of the note commitment tree unless WithTreeDepth is used.
+	DefaultTreeDepth = 32
+
+	// DefaultNumOutputs is the number of notes created unless WithOutputs is used.
+	DefaultNumOutputs = 2
+
+	// ValueBits is the size of the values of the notes and of the fee.
+	ValueBits = 64
+)
+
+type config struct {
+	hashID      hashfunctions.HashID
+	treeDepth   int
+	numOutputs  int
+	censusDepth int
+}
+
+// Option configures the circuit returned by NewXiCircuit.
+type Option func(*config)
+
+// WithHash selects the hash function used by the commitments, PRFs and signatures.
+func WithHash(h hashfunctions.HashID) Option {
+	return func(cfg *config) {
+		cfg.hashID = h
+	}
+}
+
+// WithTreeDepth sets the depth of the note commitment tree.
+func WithTreeDepth(depth int) Option {
+	return func(cfg *config) {
+		cfg.treeDepth = depth
+	}
+}
+
+// WithOutputs sets the number of notes created by the transaction.
+func WithOutputs(numOutputs int) Option {
+	return func(cfg *config) {
+		cfg.numOutputs = numOutputs
+	}
+}
+
+// WithCensusRegistry hides the census key in the published registry of census keys, a
+// tree of the given depth, instead of making it public, so that the transaction does
+// not reveal which census signed xi_R. The ElGamal key of the census is opened from the
+// same leaf, and the census is bound to xi for the delta proof.
+func WithCensusRegistry(depth int) Option {
+	return func(cfg *config) {
+		cfg.censusDepth = depth
+	}
+}
+
+// XiCircuit proves that the serial numbers SNOldList spend notes of the note commitment
+// tree, and that xi was obtained from the census for these inputs.
+//
+// The circuit has a fixed number of input slots. Only the first slots, flagged by
+// Enabled, spend notes: the others are dummies, so that the same keys serve any number
+// of inputs up to the maximum without revealing it.
+type XiCircuit struct {
 	curveID tedwards.ID
+	hashID  hashfunctions.HashID
 	Omega   []frontend.Variable
+	ROmega  frontend.Variable
 	CMOmega frontend.Variable `gnark:",public"`
 	Nu1     frontend.Variable
 	Nu2     frontend.Variable `gnark:",public"`
@@ -19,131 +83,336 @@ type xiCircuit struct {
 	AskList   []frontend.Variable
 	SNOldList []frontend.Variable `gnark:",public"`
 
+	// Enabled[i] is 1 if the i-th slot spends a note, 0 for a dummy slot. Dummy slots
+	// come last, have no value, and are not checked against the tree nor PRF_sn: their
+	// serial numbers must be sampled at random.
+	Enabled []frontend.Variable
+
+	// Notes being spent: cm_i = COMM(PRF_addr(a_sk_i)||value_i||omega_i||r_i) must be in the
+	// note commitment tree of root NoteRoot
+	NoteValues []frontend.Variable
+	NoteRList  []frontend.Variable
+	NotePaths  []merkle.CircuitPath
+	NoteRoot   frontend.Variable `gnark:",public"`
+
+	// Notes created: cm_j = COMM(a_pk_j||value_j||rho_j||r_j). The values of the
+	// notes spent are those of the notes created plus the public Fee.
+	OutApkList []frontend.Variable
+	OutValues  []frontend.Variable
+	OutRhoList []frontend.Variable
+	OutRList   []frontend.Variable
+	OutCMList  []frontend.Variable `gnark:",public"`
+	Fee        frontend.Variable   `gnark:",public"`
+
 	// Variables needed for obtainRND
 	XiUser           frontend.Variable
+	RXiUser          frontend.Variable
 	CMXiUser         frontend.Variable
 	XiCensus         frontend.Variable
 	Xi               frontend.Variable
+	RXi              frontend.Variable
 	CMXi             frontend.Variable `gnark:",public"`
 	CensusSignedData frontend.Variable
-	CensusPK         eddsa.PublicKey `gnark:",public"`
 	CensusSignature  eddsa.Signature
+
+	// Epoch of the census signature, signed with xi_R: the verifier checks it against
+	// the current epoch so that the signature can not be reused in later periods
+	Epoch frontend.Variable `gnark:",public"`
+
+	// The census key is either public (the default) or hidden in the registry of census
+	// keys (WithCensusRegistry): one of the two has a single element, the other is empty.
+	CensusPK       []eddsa.PublicKey `gnark:",public"`
+	CensusRegistry []registry.HiddenCensus
+}
+
+// NewXiCircuit returns the circuit spending up to numInputs notes, to be compiled.
+func NewXiCircuit(numInputs int, opts ...Option) *XiCircuit {
+	cfg := config{treeDepth: DefaultTreeDepth, numOutputs: DefaultNumOutputs}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	circuit := &XiCircuit{curveID: tedwards.BN254, hashID: cfg.hashID}
+	circuit.Omega = make([]frontend.Variable, numInputs)
+	circuit.AskList = make([]frontend.Variable, numInputs)
+	circuit.SNOldList = make([]frontend.Variable, numInputs)
+	circuit.Enabled = make([]frontend.Variable, numInputs)
+	circuit.NoteValues = make([]frontend.Variable, numInputs)
+	circuit.NoteRList = make([]frontend.Variable, numInputs)
+	circuit.NotePaths = make([]merkle.CircuitPath, numInputs)
+	for i := 0; i < numInputs; i++ {
+		circuit.NotePaths[i] = merkle.NewCircuitPath(cfg.treeDepth)
+	}
+	circuit.OutApkList = make([]frontend.Variable, cfg.numOutputs)
+	circuit.OutValues = make([]frontend.Variable, cfg.numOutputs)
+	circuit.OutRhoList = make([]frontend.Variable, cfg.numOutputs)
+	circuit.OutRList = make([]frontend.Variable, cfg.numOutputs)
+	circuit.OutCMList = make([]frontend.Variable, cfg.numOutputs)
+
+	if cfg.censusDepth > 0 {
+		circuit.CensusRegistry = []registry.HiddenCensus{registry.NewHiddenCensus(cfg.censusDepth)}
+	} else {
+		circuit.CensusPK = make([]eddsa.PublicKey, 1)
+	}
+
+	return circuit
+}
+
+func (circuit *XiCircuit) Define(api frontend.API) error {
+	_, err := circuit.DefineWithAddresses(api)
+	return err
 }
 
-func (circuit *xiCircuit) Define(api frontend.API) error {
+// DefineWithAddresses declares the constraints of the circuit and returns the
+// addresses PRF_addr(a_sk_i) of the input slots, so that a circuit composing the xi
+// circuit can constrain the owners of the notes spent.
+func (circuit *XiCircuit) DefineWithAddresses(api frontend.API) ([]frontend.Variable, error) {
+	if len(circuit.Enabled) == 0 {
+		return nil, ErrNoInputs
+	}
 
 	curve, err := twistededwards.NewEdCurve(api, circuit.curveID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Check that xi = Add(xiUser, xiRegulator)
 	xiRes := api.Add(circuit.XiUser, circuit.XiCensus)
 	api.AssertIsEqual(xiRes, circuit.Xi)
 
-	// Check that cmXi = Commit(xi)
-	err = Commit(api, circuit.Xi, circuit.CMXi)
+	// Check that cmXi = Commit(xi, r_xi)
+	err = Commit(api, circuit.hashID, circuit.Xi, circuit.RXi, circuit.CMXi)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Check that cmXiUser = Commit(xiUser)
-	err = Commit(api, circuit.XiUser, circuit.CMXiUser)
+	// Check that cmXiUser = Commit(xiUser, r_xiUser)
+	err = Commit(api, circuit.hashID, circuit.XiUser, circuit.RXiUser, circuit.CMXiUser)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	// The first slot spends a note and dummy slots come last
+	api.AssertIsEqual(circuit.Enabled[0], 1)
+	for i := 0; i < len(circuit.Enabled); i++ {
+		api.AssertIsBoolean(circuit.Enabled[i])
+		if i > 0 {
+			api.AssertIsEqual(api.Mul(api.Sub(1, circuit.Enabled[i-1]), circuit.Enabled[i]), 0)
+		}
+	}
+
+	// Check that the omegas of the enabled slots are strictly increasing, so that a
+	// note can not be spent twice in the same transaction
 	for i := 0; i < len(circuit.Omega)-1; i++ {
-		api.AssertIsLessOrEqual(circuit.Omega[i], circuit.Omega[i+1])
+		cmp := api.Cmp(circuit.Omega[i], circuit.Omega[i+1])
+		api.AssertIsEqual(api.Mul(circuit.Enabled[i+1], api.Add(cmp, 1)), 0)
+	}
+
+	// Check that the serial numbers are pairwise distinct, dummy ones included
+	for i := 0; i < len(circuit.SNOldList); i++ {
+		for j := i + 1; j < len(circuit.SNOldList); j++ {
+			api.AssertIsDifferent(circuit.SNOldList[i], circuit.SNOldList[j])
+		}
 	}
 
+	// The serial numbers of the dummy slots are derived as well, so that they can not
+	// be chosen to collide with pending ones
+	apks := make([]frontend.Variable, len(circuit.Omega))
 	for i := 0; i < len(circuit.Omega); i++ {
-		err := PRFSNOld(api, circuit.SNOldList[i], circuit.AskList[i], circuit.Omega[i])
+		err := PRFSNOld(api, circuit.hashID, circuit.SNOldList[i], circuit.AskList[i], circuit.Omega[i])
 		if err != nil {
-			return err
+			return nil, err
 		}
+
+		apks[i], err = circuit.assertNoteExists(api, i)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = circuit.assertBalance(api)
+	if err != nil {
+		return nil, err
+	}
+
+	// The nus only depend on the notes spent, not on the dummy slots nor on their
+	// number, so that the same notes have the same nus in circuits of any size
+	acc, err := omegaChain(api, circuit.hashID, circuit.Omega, circuit.Enabled)
+	if err != nil {
+		return nil, err
 	}
 
 	// Check that Nu1 = PRF(omega||1)
-	err = PRFNu(api, circuit.Omega, circuit.Nu1, frontend.Variable(fr.NewElement(1)))
+	err = PRFNu(api, circuit.hashID, acc, circuit.Nu1, frontend.Variable(fr.NewElement(1)))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Check that Nu1 = PRF(omega||2)
-	err = PRFNu(api, circuit.Omega, circuit.Nu2, frontend.Variable(fr.NewElement(2)))
+	// Check that Nu2 = PRF(omega||2)
+	err = PRFNu(api, circuit.hashID, acc, circuit.Nu2, frontend.Variable(fr.NewElement(2)))
+	if err != nil {
+		return nil, err
+	}
 
-	// Check that CMomega = Commit(omega)
-	mimcCMOmega, err := mimc.NewMiMC(api)
+	// Check that CMomega = Commit(omega, r_omega)
+	err = hashfunctions.AssertCommitment(api, circuit.hashID, circuit.CMOmega, circuit.ROmega, circuit.Omega[:]...)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	mimcCMOmega.Write(circuit.Omega[:]...)
-	cmOmega := mimcCMOmega.Sum()
-	api.AssertIsEqual(cmOmega, circuit.CMOmega)
 
-	// Hash(cm_u||nu_1||xi_R)
-	hfunc, err2 := mimc.NewMiMC(api)
+	// Hash(cm_u||nu_1||xi_R||epoch)
+	hfunc, err2 := circuit.hashID.NewGadget(api)
 	if err2 != nil {
-		return err2
+		return nil, err2
 	}
-	hfunc.Write(circuit.CMXiUser, circuit.Nu1, circuit.XiCensus)
+	hfunc.Write(circuit.CMXiUser, circuit.Nu1, circuit.XiCensus, circuit.Epoch)
 	signData := hfunc.Sum()
 
 	api.AssertIsEqual(signData, circuit.CensusSignedData)
 
 	// Verify sign_R
-	mimcSign, err3 := mimc.NewMiMC(api)
+	mimcSign, err3 := circuit.hashID.NewGadget(api)
+	if err3 != nil {
+		return nil, err3
+	}
+	censusPK, err3 := circuit.censusKey(api)
 	if err3 != nil {
-		return err3
+		return nil, err3
 	}
-	err3 = eddsa.Verify(curve, circuit.CensusSignature, circuit.CensusSignedData, circuit.CensusPK, &mimcSign)
+	err3 = eddsa.Verify(curve, circuit.CensusSignature, circuit.CensusSignedData, censusPK, mimcSign)
 	if err3 != nil {
-		return err3
+		return nil, err3
 	}
 
-	return nil
+	return apks, nil
 }
 
-func Commit(api frontend.API, data frontend.Variable, cmData frontend.Variable) error {
+// censusKey returns the census key, checking that it is registered if it is hidden.
+func (circuit *XiCircuit) censusKey(api frontend.API) (eddsa.PublicKey, error) {
+	if len(circuit.CensusRegistry) == 0 {
+		return circuit.CensusPK[0], nil
+	}
 
-	hfunc, err := mimc.NewMiMC(api)
+	census := &circuit.CensusRegistry[0]
+	if err := census.AssertRegistered(api, circuit.hashID, circuit.Xi); err != nil {
+		return eddsa.PublicKey{}, err
+	}
+	return census.SigKey, nil
+}
+
+// assertNoteExists checks that the i-th input is a note owned by a_sk_i whose
+// commitment is in the note commitment tree, or a dummy slot without value. It
+// returns the address of a_sk_i.
+func (circuit *XiCircuit) assertNoteExists(api frontend.API, i int) (frontend.Variable, error) {
+
+	apk, err := note.PRFAddr(api, circuit.hashID, circuit.AskList[i])
 	if err != nil {
-		return err
+		return nil, err
 	}
-	hfunc.Write(data)
-	result := hfunc.Sum()
 
-	api.AssertIsEqual(result, cmData)
+	cm, err := note.CommitmentGadget(api, circuit.hashID, apk, circuit.NoteValues[i], circuit.Omega[i], circuit.NoteRList[i])
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := circuit.NotePaths[i].ComputeRoot(api, circuit.hashID, cm)
+	if err != nil {
+		return nil, err
+	}
+	assertIfEnabled(api, circuit.Enabled[i], root, circuit.NoteRoot)
+
+	api.AssertIsEqual(api.Mul(api.Sub(1, circuit.Enabled[i]), circuit.NoteValues[i]), 0)
+
+	return apk, nil
+}
+
+// assertBalance checks the commitments of the notes created, and that the values of
+// the notes spent are those of the notes created plus the fee. The values are range
+// checked so that the sums can not wrap around the field.
+func (circuit *XiCircuit) assertBalance(api frontend.API) error {
+
+	var in, out frontend.Variable = 0, 0
+	for i := range circuit.NoteValues {
+		api.ToBinary(circuit.NoteValues[i], ValueBits)
+		in = api.Add(in, circuit.NoteValues[i])
+	}
+
+	for j := range circuit.OutValues {
+		api.ToBinary(circuit.OutValues[j], ValueBits)
+		out = api.Add(out, circuit.OutValues[j])
+
+		err := note.AssertCommitment(api, circuit.hashID, circuit.OutCMList[j],
+			circuit.OutApkList[j], circuit.OutValues[j], circuit.OutRhoList[j], circuit.OutRList[j])
+		if err != nil {
+			return err
+		}
+	}
+
+	api.ToBinary(circuit.Fee, ValueBits)
+	api.AssertIsEqual(in, api.Add(out, circuit.Fee))
 
 	return nil
 }
 
-func PRFSNOld(api frontend.API, snOld, sk, rho frontend.Variable) error {
+// assertIfEnabled checks that a = b if enabled is 1.
+func assertIfEnabled(api frontend.API, enabled, a, b frontend.Variable) {
+	api.AssertIsEqual(api.Select(enabled, a, b), b)
+}
 
-	// Compute H(sk||01||rho)
-	hfunc, err := mimc.NewMiMC(api)
+// Commit checks that cmData is the hiding commitment H(data||r)
+func Commit(api frontend.API, h hashfunctions.HashID, data, r frontend.Variable, cmData frontend.Variable) error {
+	return hashfunctions.AssertCommitment(api, h, cmData, r, data)
+}
+
+func PRFSNOld(api frontend.API, h hashfunctions.HashID, snOld, sk, rho frontend.Variable) error {
+
+	result, err := prfSNOld(api, h, sk, rho)
 	if err != nil {
 		return err
 	}
-	hfunc.Write(sk)
-	hfunc.Write(frontend.Variable([]byte{0b0, 0b1}))
-	hfunc.Write(rho)
-	result := hfunc.Sum()
 
 	// Check SN_old = H(sk||01||rho)
 	api.AssertIsEqual(result, snOld)
 	return nil
 }
 
-func PRFNu(api frontend.API, omega []frontend.Variable, nu, i frontend.Variable) error {
+// prfSNOld computes H(sk||01||rho).
+func prfSNOld(api frontend.API, h hashfunctions.HashID, sk, rho frontend.Variable) (frontend.Variable, error) {
+
+	hfunc, err := h.NewGadget(api)
+	if err != nil {
+		return nil, err
+	}
+	hfunc.Write(sk)
+	hfunc.Write(frontend.Variable([]byte{0b0, 0b1}))
+	hfunc.Write(rho)
+
+	return hfunc.Sum(), nil
+}
+
+// omegaChain computes the chain acc of hashfunctions.PRFNu over the omegas of the
+// enabled slots.
+func omegaChain(api frontend.API, h hashfunctions.HashID, omega, enabled []frontend.Variable) (frontend.Variable, error) {
+	var acc frontend.Variable = 0
+	for k := range omega {
+		hfunc, err := h.NewGadget(api)
+		if err != nil {
+			return nil, err
+		}
+		hfunc.Write(acc, omega[k])
+		acc = api.Select(enabled[k], hfunc.Sum(), acc)
+	}
+	return acc, nil
+}
+
+// PRFNu checks that nu = H(acc||i), for the chain acc of the omegas spent.
+func PRFNu(api frontend.API, h hashfunctions.HashID, acc, nu, i frontend.Variable) error {
 
-	mimcNu1, err := mimc.NewMiMC(api)
+	mimcNu1, err := h.NewGadget(api)
 	if err != nil {
 		return err
 	}
-	mimcNu1.Write(omega[:]...)
-	mimcNu1.Write(i)
+	mimcNu1.Write(acc, i)
 	result := mimcNu1.Sum()
 	api.AssertIsEqual(result, nu)
 
@@ -1,45 +1,40 @@
 package xicircuit
 
 import (
+	"blockchain_DP/elgamal"
 	"blockchain_DP/hashfunctions"
+	"blockchain_DP/merkle"
+	"blockchain_DP/note"
+	"blockchain_DP/prover"
+	"blockchain_DP/registry"
 	crand "crypto/rand"
+	"encoding/json"
 	"fmt"
-	"sort"
+	"math"
+	"math/big"
 	"testing"
 	"time"
 
 	"github.com/consensys/gnark-crypto/ecc"
 	fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
 	"github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
-	tedwards "github.com/consensys/gnark-crypto/ecc/twistededwards"
-	"github.com/consensys/gnark-crypto/hash"
-	"github.com/consensys/gnark-crypto/signature"
-	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend"
 	"github.com/consensys/gnark/frontend"
-	"github.com/consensys/gnark/frontend/cs/r1cs"
-	"github.com/consensys/gnark/std/algebra/twistededwards"
 	"github.com/consensys/gnark/test"
 )
 
-type InputOutput struct {
-	Omega     []fr.Element
-	AskList   []fr.Element
-	SNOldList []fr.Element
-
-	Nu1     []byte
-	Nu2     []byte
-	CMOmega []byte
-
-	XiUser   fr.Element
-	XiCensus fr.Element
-	Xi       fr.Element
-	CMXi     []byte
-	CMXiUser []byte
+const (
+	// treeDepth is the depth of the note commitment tree used in the tests
+	treeDepth = 16
 
-	SignedData []byte
+	// inputValue is the value of each note spent in the tests
+	inputValue = 5
+)
 
-	CensusPK        signature.PublicKey
-	CensusSignature []byte
+type InputOutput struct {
+	Notes []SpentNote
+	Input XiWitnessInput
+	Witness
 }
 
 func TestXiCircuit(t *testing.T) {
@@ -53,7 +48,7 @@ func TestXiCircuit(t *testing.T) {
 		n := 100
 
 		for i := 0; i < n; i++ {
-			timeS, timeP, timeV := RunBenchmark(t, numInputs, i)
+			timeS, timeP, timeV := RunBenchmark(t, numInputs, i, hashfunctions.MiMC, backend.GROTH16)
 			sumS += timeS
 			sumP += timeP
 			sumV += timeV
@@ -65,89 +60,103 @@ func TestXiCircuit(t *testing.T) {
 	}
 }
 
-func RunBenchmark(t *testing.T, numInputs int, iteration int) (time.Duration, time.Duration, time.Duration) {
-
-	assert := test.NewAssert(t)
-
-	snarkCurve, err := twistededwards.GetSnarkCurve(tedwards.BN254)
-	assert.NoError(err)
-
-	vals := setUpInputOutput(t, numInputs)
-
-	var circuit xiCircuit
-	circuit.curveID = tedwards.BN254
-	circuit.Omega = make([]frontend.Variable, len(vals.Omega))
-	circuit.AskList = make([]frontend.Variable, len(vals.AskList))
-	circuit.SNOldList = make([]frontend.Variable, len(vals.SNOldList))
-
-	// verification with the correct data
-	var assignment xiCircuit
-
-	assignment.Omega = make([]frontend.Variable, len(vals.Omega))
-	for i := 0; i < len(vals.Omega); i++ {
-		assignment.Omega[i] = vals.Omega[i]
+func TestXiCircuitHashFunctions(t *testing.T) {
+	for _, hashID := range []hashfunctions.HashID{
+		hashfunctions.MiMC, hashfunctions.Poseidon,
+	} {
+		for _, numInputs := range []int{
+			1, 4,
+		} {
+			_, timeP, _ := RunBenchmark(t, numInputs, 0, hashID, backend.GROTH16)
+			fmt.Println(hashID, numInputs, "Proof time:", timeP)
+		}
 	}
+}
 
-	assignment.AskList = make([]frontend.Variable, len(vals.AskList))
-	for i := 0; i < len(vals.AskList); i++ {
-		assignment.AskList[i] = vals.AskList[i]
+func TestXiCircuitBackends(t *testing.T) {
+	for _, backendID := range []backend.ID{
+		backend.GROTH16, backend.PLONK,
+	} {
+		for _, numInputs := range []int{
+			1, 2, 4, 8, 16,
+		} {
+			timeS, timeP, timeV := RunBenchmark(t, numInputs, 0, hashfunctions.MiMC, backendID)
+			fmt.Println(backendID, numInputs, "Setup time:", timeS)
+			fmt.Println(backendID, numInputs, "Proof time:", timeP)
+			fmt.Println(backendID, numInputs, "Verification time:", timeV)
+		}
 	}
+}
 
-	assignment.SNOldList = make([]frontend.Variable, len(vals.SNOldList))
-	for i := 0; i < len(vals.SNOldList); i++ {
-		assignment.SNOldList[i] = vals.SNOldList[i]
-	}
+func TestXiCircuitCommitmentOpening(t *testing.T) {
+
+	assert := test.NewAssert(t)
+
+	vals := setUpInputOutput(t, 2, hashfunctions.MiMC)
+	circuit, assignment := setUpCircuit(t, vals, hashfunctions.MiMC)
 
-	assignment.Nu1 = vals.Nu1
-	assignment.Nu2 = vals.Nu2
-	assignment.CMOmega = vals.CMOmega
+	err := test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16)
+	assert.NoError(err)
 
-	assignment.XiUser = vals.XiUser.Marshal()
-	assignment.XiCensus = vals.XiCensus.Marshal()
-	assignment.Xi = vals.Xi
-	assignment.CMXi = vals.CMXi
-	assignment.CMXiUser = vals.CMXiUser
+	// a commitment to xi without its opening must not be accepted
+	var r fr.Element
+	_, err = r.SetRandom()
+	assert.NoError(err)
+	assignment.RXi = r
+	err = test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16)
+	assert.Error(err, "wrong opening of cm_xi")
+
+	// a commitment to xi_U without its opening must not be accepted
+	assignment.RXi = vals.RXi
+	assignment.RXiUser = r
+	err = test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16)
+	assert.Error(err, "wrong opening of cm_xi_U")
+}
 
-	assignment.CensusSignedData = vals.SignedData
+func RunBenchmark(t *testing.T, numInputs int, iteration int, hashID hashfunctions.HashID, backendID backend.ID) (time.Duration, time.Duration, time.Duration) {
 
-	assignment.CensusPK.Assign(snarkCurve, vals.CensusPK.Bytes())
-	assignment.CensusSignature.Assign(snarkCurve, vals.CensusSignature)
+	vals := setUpInputOutput(t, numInputs, hashID)
+	circuit, assignment := setUpCircuit(t, vals, hashID)
 
-	ccs, err := frontend.Compile(ecc.BN254, r1cs.NewBuilder, &circuit)
+	ccs, err := prover.Compile(circuit, prover.WithBackend(backendID))
 	if err != nil {
 		panic(err)
 	}
 
+	opts := []prover.Option{prover.WithBackend(backendID)}
+	if backendID == backend.PLONK {
+		srs, err := prover.NewUnsafeSRS(prover.SRSSize(ccs))
+		if err != nil {
+			panic(err)
+		}
+		opts = append(opts, prover.WithSRS(srs))
+	}
+
 	t1 := time.Now()
-	pk, vk, err := groth16.Setup(ccs)
+	keys, err := prover.Setup(ccs, opts...)
 	if err != nil {
 		panic(err)
 	}
 	timeS := time.Since(t1)
 
 	if iteration == 0 {
-		fmt.Println("Total", ccs.GetNbConstraints(), "constraints")
+		fmt.Println(backendID, hashID, "Total", ccs.GetNbConstraints(), "constraints")
 	}
 
-	witness, err := frontend.NewWitness(&assignment, ecc.BN254)
-	if err != nil {
-		panic(err)
-	}
-
-	publicWitness, err := witness.Public()
+	publicWitness, err := prover.PublicWitness(assignment)
 	if err != nil {
 		panic(err)
 	}
 
 	t1 = time.Now()
-	proof, err := groth16.Prove(ccs, pk, witness)
+	proof, err := prover.Prove(keys, assignment)
 	if err != nil {
 		panic(err)
 	}
 	timeP := time.Since(t1)
 
 	t1 = time.Now()
-	err = groth16.Verify(proof, vk, publicWitness)
+	err = prover.Verify(keys.VK, proof, publicWitness)
 	if err != nil {
 		panic(err)
 	}
@@ -156,94 +165,503 @@ func RunBenchmark(t *testing.T, numInputs int, iteration int) (time.Duration, ti
 	return timeS, timeP, timeV
 }
 
-func setUpInputOutput(t *testing.T, numInputs int) InputOutput {
+func setUpCircuit(t *testing.T, vals InputOutput, hashID hashfunctions.HashID) (circuit, assignment *XiCircuit) {
 
 	assert := test.NewAssert(t)
 
-	var vals InputOutput
+	circuit = NewXiCircuit(len(vals.Omega), WithHash(hashID), WithTreeDepth(treeDepth))
+
+	// verification with the correct data
+	assignment, err := vals.Assign()
+	assert.NoError(err)
 
-	// generate values to sign
-	_, err := vals.XiUser.SetRandom()
-	assert.NoError(err, "Setting random value (xi_U)")
+	return circuit, assignment
+}
 
-	// Creating commitment for xiUser using MiMC
-	hfunc := hash.MIMC_BN254.New()
-	hfunc.Write(vals.XiUser.Marshal())
-	vals.CMXiUser = hfunc.Sum(nil)
+func setUpInputOutput(t *testing.T, numInputs int, hashID hashfunctions.HashID) InputOutput {
+	return setUpPaddedInputOutput(t, numInputs, numInputs, hashID)
+}
 
-	_, err = vals.XiCensus.SetRandom()
-	assert.NoError(err, "Setting random value (xi_R)")
+// setUpPaddedInputOutput spends numInputs notes in a circuit of numSlots slots.
+func setUpPaddedInputOutput(t *testing.T, numInputs, numSlots int, hashID hashfunctions.HashID) InputOutput {
 
-	vals.Xi.Add(&vals.XiUser, &vals.XiCensus)
+	assert := test.NewAssert(t)
 
-	hfunc2 := hash.MIMC_BN254.New()
-	hfunc2.Write(vals.Xi.Marshal())
-	vals.CMXi = hfunc2.Sum(nil)
+	var vals InputOutput
+	var in XiWitnessInput
 
-	//numInputs := 2
+	// Create the notes being spent, each one owned by a different a_sk,
+	// and add them to a note commitment tree among other notes
+	tree, err := merkle.New(hashID, treeDepth)
+	assert.NoError(err)
 
-	vals.Omega = make([]fr.Element, numInputs)
+	vals.Notes = make([]SpentNote, numInputs)
 	for i := 0; i < numInputs; i++ {
-		var temp fr.Element
-		_, err := temp.SetRandom()
+		var other fr.Element
+		_, err = other.SetRandom()
+		assert.NoError(err)
+		_, err = tree.Append(other)
 		assert.NoError(err)
-		vals.Omega[i].Set(&temp)
-	}
 
-	// Sort Omega in ascending order
-	sort.Slice(vals.Omega, func(i, j int) bool {
-		if vals.Omega[i].Cmp(&vals.Omega[j]) <= 0 {
-			return true
-		} else {
-			return false
-		}
-	})
+		_, err = vals.Notes[i].Ask.SetRandom()
+		assert.NoError(err)
+		vals.Notes[i].Note, err = note.New(note.Address(hashID, vals.Notes[i].Ask), inputValue)
+		assert.NoError(err)
 
-	vals.AskList = make([]fr.Element, numInputs)
-	for i := 0; i < numInputs; i++ {
-		var temp fr.Element
-		_, err := temp.SetRandom()
+		var cm fr.Element
+		cm.SetBytes(vals.Notes[i].Note.Commitment(hashID))
+		_, err = tree.Append(cm)
 		assert.NoError(err)
-		vals.AskList[i].Set(&temp)
 	}
 
-	vals.SNOldList = make([]fr.Element, numInputs)
+	in.NoteRoot = tree.Root()
 	for i := 0; i < numInputs; i++ {
-		vals.SNOldList[i] = hashfunctions.PFRSN(vals.AskList[i], vals.Omega[i])
+		vals.Notes[i].Path, err = tree.Path(uint64(2*i + 1))
+		assert.NoError(err)
 	}
-
-	// Creating serial number Nu1
-	vals.Nu1 = hashfunctions.PRFNu(vals.Omega, fr.NewElement(1))
-
-	// Creating serial number Nu2
-	vals.Nu2 = hashfunctions.PRFNu(vals.Omega, fr.NewElement(2))
-
-	// Creating commitment over vals.Omega
-	hCMomega := hash.MIMC_BN254.New()
-	for i := 0; i < len(vals.Omega); i++ {
-		hCMomega.Write(vals.Omega[i].Marshal())
+	in.Spent = vals.Notes
+	in.Slots = numSlots
+
+	// Create the notes receiving the values spent, minus the fee
+	in.Fee = 1
+	in.Created = make([]note.Note, DefaultNumOutputs)
+	for j, value := range []uint64{inputValue*uint64(numInputs) - 3, 2} {
+		var ask fr.Element
+		_, err = ask.SetRandom()
+		assert.NoError(err)
+		in.Created[j], err = note.New(note.Address(hashID, ask), value)
+		assert.NoError(err)
 	}
-	vals.CMOmega = hCMomega.Sum(nil)
 
-	hfunc3 := hash.MIMC_BN254.New()
-	hfunc3.Write(vals.CMXiUser)
-	hfunc3.Write(vals.Nu1)
-	hfunc3.Write(vals.XiCensus.Marshal())
-	vals.SignedData = hfunc3.Sum(nil)
+	// xi = xi_U + xi_R, where the census signs cm_u||nu_1||xi_R for the current epoch
+	for _, e := range []*fr.Element{&in.XiUser, &in.RXiUser, &in.XiCensus} {
+		_, err = e.SetRandom()
+		assert.NoError(err)
+	}
+	in.Epoch = 1
+	nu1, err := in.Nu1(hashID)
+	assert.NoError(err)
+	signedData := SignedData(hashID, hashID.Commit(in.RXiUser, in.XiUser), nu1, in.XiCensus, in.Epoch)
 
-	// generate parameters for the signatures
 	privKey, err := eddsa.GenerateKey(crand.Reader)
 	assert.NoError(err, "generating eddsa key pair")
-
-	// generate signature
-	vals.CensusSignature, err = privKey.Sign(vals.SignedData[:], hash.MIMC_BN254.New())
+	in.CensusSignature, err = privKey.Sign(signedData, hashID.New())
 	assert.NoError(err, "signing message")
+	in.CensusPK = privKey.Public()
+
+	w, err := in.Build(hashID)
+	assert.NoError(err)
+	vals.Input, vals.Witness = in, *w
 
 	// check if there is no problem in the signature
-	vals.CensusPK = privKey.Public()
-	checkSig, err := vals.CensusPK.Verify(vals.CensusSignature, vals.SignedData[:], hash.MIMC_BN254.New())
+	checkSig, err := vals.CensusPK.Verify(vals.CensusSignature, vals.SignedData, hashID.New())
 	assert.NoError(err, "verifying signature")
 	assert.True(checkSig, "signature verification failed")
 
 	return vals
 }
+
+func TestXiWitnessInput(t *testing.T) {
+
+	assert := test.NewAssert(t)
+
+	vals := setUpPaddedInputOutput(t, 2, 3, hashfunctions.MiMC)
+	circuit := NewXiCircuit(3, WithHash(hashfunctions.MiMC), WithTreeDepth(treeDepth))
+	assignment, public, err := vals.Input.Assign(hashfunctions.MiMC)
+	assert.NoError(err)
+	assert.NoError(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+
+	// the serial numbers and nus are those of the notes spent
+	for i, spent := range vals.Notes {
+		sn := spent.Note.SerialNumber(hashfunctions.MiMC, spent.Ask)
+		assert.True(sn.Equal(&vals.SNOldList[i]) || sn.Equal(&vals.SNOldList[1-i]))
+	}
+	data, err := public.MarshalJSON()
+	assert.NoError(err)
+	var values struct {
+		Nu2       fr.Element
+		SNOldList []fr.Element
+	}
+	assert.NoError(json.Unmarshal(data, &values))
+	assert.Equal(vals.Nu2, values.Nu2.Marshal())
+	assert.Equal(3, len(values.SNOldList))
+
+	// the randomness of the commitments is fresh for each witness
+	other, err := vals.Input.Build(hashfunctions.MiMC)
+	assert.NoError(err)
+	assert.Equal(vals.Nu1, other.Nu1)
+	assert.NotEqual(vals.CMXi, other.CMXi)
+
+	// the nus do not depend on the number of slots
+	for _, slots := range []int{2, 4} {
+		in := vals.Input
+		in.Slots = slots
+		nu1, err := in.Nu1(hashfunctions.MiMC)
+		assert.NoError(err)
+		assert.Equal(vals.Nu1, nu1, slots)
+
+		w, err := in.Build(hashfunctions.MiMC)
+		assert.NoError(err)
+		assert.Equal(vals.Nu2, w.Nu2, slots)
+		err = test.IsSolved(NewXiCircuit(slots, WithTreeDepth(treeDepth)), mustAssign(t, InputOutput{Witness: *w}), ecc.BN254, backend.GROTH16)
+		assert.NoError(err, slots)
+	}
+
+	// a note spent by another key
+	vals.Input.Spent = []SpentNote{vals.Notes[0]}
+	vals.Input.Spent[0].Ask = vals.Notes[1].Ask
+	_, _, err = vals.Input.Assign(hashfunctions.MiMC)
+	assert.ErrorIs(err, ErrNotOwner)
+}
+
+func TestInputsFromNotes(t *testing.T) {
+
+	assert := test.NewAssert(t)
+
+	vals := setUpInputOutput(t, 4, hashfunctions.MiMC)
+	for i := 1; i < len(vals.Omega); i++ {
+		assert.True(vals.Omega[i-1].Cmp(&vals.Omega[i]) < 0, "omega must be sorted")
+	}
+
+	// spending a note with a key that does not own it is rejected
+	inputs := append([]SpentNote{}, vals.Notes...)
+	inputs[0].Ask = inputs[1].Ask
+	_, err := InputsFromNotes(hashfunctions.MiMC, inputs)
+	assert.ErrorIs(err, ErrNotOwner)
+}
+
+func TestXiCircuitNoteMembership(t *testing.T) {
+
+	assert := test.NewAssert(t)
+
+	vals := setUpInputOutput(t, 2, hashfunctions.MiMC)
+	circuit, assignment := setUpCircuit(t, vals, hashfunctions.MiMC)
+
+	err := test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16)
+	assert.NoError(err)
+
+	// a forged note (not in the tree) is rejected
+	var r fr.Element
+	_, err = r.SetRandom()
+	assert.NoError(err)
+	assignment.NoteRList[0] = r
+	err = test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16)
+	assert.Error(err, "forged note must not be spendable")
+
+	// so is a valid path against another root
+	assignment.NoteRList[0] = vals.NoteRList[0]
+	assignment.NoteRoot = vals.Omega[0]
+	err = test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16)
+	assert.Error(err, "note must be in the tree of the public root")
+}
+
+func TestXiCircuitEpoch(t *testing.T) {
+
+	assert := test.NewAssert(t)
+
+	vals := setUpInputOutput(t, 1, hashfunctions.MiMC)
+	circuit, assignment := setUpCircuit(t, vals, hashfunctions.MiMC)
+	assert.NoError(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+
+	// the signature of an epoch is not valid for another
+	assignment.Epoch = vals.Epoch + 1
+	assert.Error(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+
+	// nor is the signed data of another epoch
+	assignment.CensusSignedData = SignedData(hashfunctions.MiMC, vals.CMXiUser, vals.Nu1, vals.XiCensus, vals.Epoch+1)
+	assert.Error(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+}
+
+func TestXiCircuitCensusRegistry(t *testing.T) {
+
+	assert := test.NewAssert(t)
+
+	const depth = 8
+	vals := setUpInputOutput(t, 1, hashfunctions.MiMC)
+
+	// the registry holds the census signing xi_R among others, each by its signing
+	// and encryption keys
+	tree, err := merkle.New(hashfunctions.MiMC, depth)
+	assert.NoError(err)
+	for i := 0; i < 2; i++ {
+		otherSig, err := eddsa.GenerateKey(crand.Reader)
+		assert.NoError(err)
+		otherEnc, err := elgamal.GenerateKey(crand.Reader)
+		assert.NoError(err)
+		_, err = tree.Append(registry.CensusLeaf(hashfunctions.MiMC, otherSig.PublicKey.A, otherEnc.PublicKey.A))
+		assert.NoError(err)
+	}
+	encKey, err := elgamal.GenerateKey(crand.Reader)
+	assert.NoError(err)
+	leaf := registry.CensusLeaf(hashfunctions.MiMC, vals.CensusPK.(*eddsa.PublicKey).A, encKey.PublicKey.A)
+	index, err := tree.Append(leaf)
+	assert.NoError(err)
+	vals.CensusPath, err = tree.Path(index)
+	assert.NoError(err)
+	vals.CensusRoot = tree.Root()
+	vals.CensusEncPK = encKey.PublicKey
+	vals.CensusBinding = registry.CensusBinding(hashfunctions.MiMC, leaf, vals.Xi)
+
+	circuit := NewXiCircuit(1, WithHash(hashfunctions.MiMC), WithTreeDepth(treeDepth), WithCensusRegistry(depth))
+	assignment, err := vals.Assign()
+	assert.NoError(err)
+	assert.NoError(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+	assert.Equal(0, len(assignment.CensusPK), "the census key is not public")
+
+	// the signing key of the census with another encryption key
+	other := vals
+	unknown, err := elgamal.GenerateKey(crand.Reader)
+	assert.NoError(err)
+	other.CensusEncPK = unknown.PublicKey
+	assignment, err = other.Assign()
+	assert.NoError(err)
+	assert.Error(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+
+	// the census bound to another xi
+	other = vals
+	other.CensusBinding = registry.CensusBinding(hashfunctions.MiMC, leaf, vals.XiCensus)
+	assignment, err = other.Assign()
+	assert.NoError(err)
+	assert.Error(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+
+	// a signature by a census which is not registered
+	privKey, err := eddsa.GenerateKey(crand.Reader)
+	assert.NoError(err)
+	vals.CensusSignature, err = privKey.Sign(vals.SignedData, hashfunctions.MiMC.New())
+	assert.NoError(err)
+	vals.CensusPK = privKey.Public()
+	assignment, err = vals.Assign()
+	assert.NoError(err)
+	assert.Error(test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16))
+}
+
+func TestWitnessAssign(t *testing.T) {
+
+	assert := test.NewAssert(t)
+
+	vals := setUpInputOutput(t, 2, hashfunctions.MiMC)
+
+	// a malformed signature is reported as an error
+	vals.CensusSignature = []byte{1, 2, 3}
+	_, err := vals.Assign()
+	assert.Error(err)
+
+	vals = setUpInputOutput(t, 2, hashfunctions.MiMC)
+	vals.AskList = vals.AskList[:1]
+	_, err = vals.Assign()
+	assert.Error(err)
+}
+
+func TestXiCircuitPadding(t *testing.T) {
+
+	assert := test.NewAssert(t)
+
+	// the same circuit spends any number of notes up to its number of slots
+	circuit := NewXiCircuit(4, WithTreeDepth(treeDepth))
+	for _, numInputs := range []int{1, 3, 4} {
+		vals := setUpPaddedInputOutput(t, numInputs, 4, hashfunctions.MiMC)
+		assignment, err := vals.Assign()
+		assert.NoError(err)
+		err = test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16)
+		assert.NoError(err, numInputs)
+	}
+
+	vals := setUpPaddedInputOutput(t, 2, 4, hashfunctions.MiMC)
+	err := test.IsSolved(circuit, mustAssign(t, vals), ecc.BN254, backend.GROTH16)
+	assert.NoError(err)
+
+	// the nus do not depend on the omegas of the dummy slots
+	nu := vals.Nu1
+	padded := vals
+	padded.Inputs = cloneInputs(vals.Inputs)
+	_, err = padded.Omega[3].SetRandom()
+	assert.NoError(err)
+	padded.SNOldList[3] = hashfunctions.MiMC.PRFSN(padded.AskList[3], padded.Omega[3])
+	assert.Equal(nu, hashfunctions.MiMC.PRFNu(padded.SpentOmega(), fr.NewElement(1)))
+	padded.CMOmega = hashfunctions.MiMC.Commit(padded.ROmega, padded.Omega...)
+	err = test.IsSolved(circuit, mustAssign(t, padded), ecc.BN254, backend.GROTH16)
+	assert.NoError(err)
+
+	// the flags are checked by the circuit, not only by Assign
+	for _, c := range []struct {
+		enabled []frontend.Variable
+		msg     string
+	}{
+		{[]frontend.Variable{1, 1, 1, 0}, "dummy slot enabled"},
+		{[]frontend.Variable{1, 0, 1, 0}, "dummy slot before a note"},
+		{[]frontend.Variable{0, 0, 0, 0}, "no note spent"},
+		{[]frontend.Variable{1, 0, 0, 0}, "note disabled"},
+		{[]frontend.Variable{1, 1, 2, 0}, "flag not boolean"},
+	} {
+		assignment := mustAssign(t, vals)
+		assignment.Enabled = c.enabled
+		err = test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16)
+		assert.Error(err, c.msg)
+	}
+
+	// the serial number of a dummy slot is derived from its a_sk and omega, so that it
+	// can not be set to a pending one
+	var pending fr.Element
+	_, err = pending.SetRandom()
+	assert.NoError(err)
+	assignment := mustAssign(t, vals)
+	assignment.SNOldList[3] = pending
+	err = test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16)
+	assert.Error(err, "dummy slot with a chosen serial number")
+
+	// dummy slots have no value
+	assignment = mustAssign(t, vals)
+	assignment.NoteValues[3] = 1
+	assignment.Fee = 2
+	err = test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16)
+	assert.Error(err, "dummy slot with a value")
+
+	// there are no more inputs than slots
+	in := vals.Inputs
+	assert.ErrorIs(in.Pad(hashfunctions.MiMC, 3), ErrTooManyInputs)
+}
+
+func TestXiCircuitNoInputs(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	_, err := prover.Compile(NewXiCircuit(0, WithTreeDepth(treeDepth)))
+	assert.ErrorIs(err, ErrNoInputs)
+
+	var in Inputs
+	assert.ErrorIs(in.Pad(hashfunctions.MiMC, 2), ErrNoInputs)
+	assert.ErrorIs(in.Check(), ErrNoInputs)
+
+	// a slot without a path
+	in = cloneInputs(setUpPaddedInputOutput(t, 1, 2, hashfunctions.MiMC).Inputs)
+	in.NotePaths = nil
+	assert.ErrorIs(in.Pad(hashfunctions.MiMC, 2), ErrInputLengths)
+	assert.ErrorIs(in.Check(), ErrInputLengths)
+}
+
+func mustAssign(t *testing.T, vals InputOutput) *XiCircuit {
+	assignment, err := vals.Assign()
+	test.NewAssert(t).NoError(err)
+	return assignment
+}
+
+func TestXiCircuitDuplicateInputs(t *testing.T) {
+
+	assert := test.NewAssert(t)
+
+	vals := setUpPaddedInputOutput(t, 2, 3, hashfunctions.MiMC)
+	circuit := NewXiCircuit(3, WithTreeDepth(treeDepth))
+	err := test.IsSolved(circuit, mustAssign(t, vals), ecc.BN254, backend.GROTH16)
+	assert.NoError(err)
+
+	// spending the same note twice is refused before proving...
+	_, err = InputsFromNotes(hashfunctions.MiMC, []SpentNote{vals.Notes[0], vals.Notes[0]})
+	assert.ErrorIs(err, ErrDuplicateInput)
+
+	twice := vals
+	twice.Inputs = cloneInputs(vals.Inputs)
+	twice.Omega[1], twice.AskList[1], twice.SNOldList[1] = vals.Omega[0], vals.AskList[0], vals.SNOldList[0]
+	_, err = twice.Assign()
+	assert.ErrorIs(err, ErrDuplicateInput)
+
+	// ...and by the circuit, which would otherwise accept a non-decreasing omega
+	assignment := mustAssign(t, vals)
+	for _, slots := range [][]frontend.Variable{
+		assignment.Omega, assignment.AskList, assignment.SNOldList, assignment.NoteValues, assignment.NoteRList,
+	} {
+		slots[1] = slots[0]
+	}
+	assignment.NotePaths[1] = assignment.NotePaths[0]
+	err = test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16)
+	assert.Error(err, "note spent twice")
+
+	// unsorted inputs are refused
+	unsorted := vals
+	unsorted.Inputs = cloneInputs(vals.Inputs)
+	unsorted.Omega[0], unsorted.Omega[1] = vals.Omega[1], vals.Omega[0]
+	_, err = unsorted.Assign()
+	assert.ErrorIs(err, ErrUnsorted)
+
+	// a dummy slot can not reuse the serial number of a note
+	dummy := vals
+	dummy.Inputs = cloneInputs(vals.Inputs)
+	dummy.SNOldList[2] = vals.SNOldList[0]
+	_, err = dummy.Assign()
+	assert.ErrorIs(err, ErrDuplicateSN)
+
+	assignment = mustAssign(t, vals)
+	assignment.SNOldList[2] = assignment.SNOldList[0]
+	err = test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16)
+	assert.Error(err, "serial number appears twice")
+}
+
+// cloneInputs returns a deep copy of in.
+func cloneInputs(in Inputs) Inputs {
+	return Inputs{
+		Omega:      append([]fr.Element{}, in.Omega...),
+		AskList:    append([]fr.Element{}, in.AskList...),
+		SNOldList:  append([]fr.Element{}, in.SNOldList...),
+		Enabled:    append([]bool{}, in.Enabled...),
+		NoteValues: append([]uint64{}, in.NoteValues...),
+		NoteRList:  append([]fr.Element{}, in.NoteRList...),
+		NotePaths:  append([]merkle.Path{}, in.NotePaths...),
+	}
+}
+
+func TestXiCircuitBalance(t *testing.T) {
+
+	assert := test.NewAssert(t)
+
+	vals := setUpInputOutput(t, 2, hashfunctions.MiMC)
+	circuit, assignment := setUpCircuit(t, vals, hashfunctions.MiMC)
+	err := test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16)
+	assert.NoError(err)
+
+	// the fee is the difference between the values spent and created
+	unbalanced := vals
+	unbalanced.Fee = 2
+	_, err = unbalanced.Assign()
+	assert.ErrorIs(err, ErrUnbalanced)
+
+	assignment.Fee = 2
+	err = test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16)
+	assert.Error(err, "unbalanced transaction")
+
+	// values balancing only modulo the field order are out of range
+	var modulus, twoTo64 big.Int
+	modulus.Set(fr.Modulus())
+	twoTo64.Lsh(big.NewInt(1), ValueBits)
+	spent := big.NewInt(2*inputValue - 1)
+	for _, c := range []struct {
+		out0, out1, fee *big.Int
+		msg             string
+	}{
+		{big.NewInt(2*inputValue - 3), big.NewInt(2), big.NewInt(1), ""},
+		{new(big.Int).Add(spent, big.NewInt(3)), new(big.Int).Sub(&modulus, big.NewInt(3)), big.NewInt(1), "negative value"},
+		{new(big.Int).Add(spent, &twoTo64), new(big.Int).Sub(&modulus, &twoTo64), big.NewInt(1), "value of 2^64"},
+		{new(big.Int).Add(spent, big.NewInt(2)), big.NewInt(0), new(big.Int).Sub(&modulus, big.NewInt(1)), "negative fee"},
+	} {
+		_, assignment = setUpCircuit(t, vals, hashfunctions.MiMC)
+		for j, value := range []*big.Int{c.out0, c.out1} {
+			var v fr.Element
+			v.SetBigInt(value)
+			var cm fr.Element
+			cm.SetBytes(hashfunctions.MiMC.Commit(vals.OutRList[j], vals.OutApkList[j], v, vals.OutRhoList[j]))
+			assignment.OutValues[j] = value
+			assignment.OutCMList[j] = cm
+		}
+		assignment.Fee = c.fee
+		err = test.IsSolved(circuit, assignment, ecc.BN254, backend.GROTH16)
+		if c.msg == "" {
+			assert.NoError(err)
+		} else {
+			assert.Error(err, c.msg)
+		}
+	}
+
+	// sums of values overflowing 64 bits are refused before proving
+	in := Inputs{NoteValues: []uint64{math.MaxUint64, 1}}
+	err = CheckBalance(&in, &Outputs{OutValues: []uint64{0}}, 0)
+	assert.ErrorIs(err, ErrOverflow)
+	err = CheckBalance(&Inputs{NoteValues: []uint64{1}}, &Outputs{OutValues: []uint64{1}}, math.MaxUint64)
+	assert.ErrorIs(err, ErrOverflow)
+}